@@ -0,0 +1,240 @@
+// Package admin expose an http.Handler for inspecting and controlling pools
+// registered in pond, see pond.Register.
+//
+// Routes, relative to where the handler is mounted:
+//
+//	GET  /                              list all registered pools
+//	GET  /pools/{name}                  show one pool
+//	POST /pools/{name}/pause            pause pool
+//	POST /pools/{name}/resume           resume pool
+//	POST /pools/{name}/capacity         set capacity, form value "capacity"
+//	POST /pools/{name}/purge-duration   set purge duration, form value "duration"
+//
+// State, capacity, purge duration and running tasks are only shown or set
+// for pools supporting them, e.g. pools of pond. Running tasks are listed
+// only if tracked, see pond.WithRunningTasks.
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"pond/pond"
+)
+
+// defaultMaxRunningTasks is the default number of longest running tasks
+// shown per pool.
+const defaultMaxRunningTasks = 5
+
+// Option configures optional behaviors of Handler.
+type Option func(*Handler)
+
+// WithAuth make handler reject requests with 403 if auth return error,
+// it is invoked ahead of every request.
+func WithAuth(auth func(r *http.Request) error) Option {
+	return func(h *Handler) {
+		h.auth = auth
+	}
+}
+
+// WithMaxRunningTasks set the number of longest running tasks shown per
+// pool, default is defaultMaxRunningTasks.
+func WithMaxRunningTasks(n int) Option {
+	return func(h *Handler) {
+		h.maxRunning = n
+	}
+}
+
+// Handler serve inspection and control of registered pools over HTTP.
+type Handler struct {
+	auth       func(r *http.Request) error
+	maxRunning int
+}
+
+// NewHandler return a new Handler configured by opts.
+func NewHandler(opts ...Option) *Handler {
+	h := &Handler{maxRunning: defaultMaxRunningTasks}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// PoolView is the JSON view of a pool.
+type PoolView struct {
+	Name           string     `json:"name"`
+	State          string     `json:"state"`
+	Capacity       int        `json:"capacity"`
+	Workers        int        `json:"workers"`
+	Queued         int        `json:"queued"`
+	Stats          pond.Stats `json:"stats"`
+	LongestRunning []TaskView `json:"longest_running"`
+}
+
+// TaskView is the JSON view of a running task.
+type TaskView struct {
+	ID      string            `json:"id,omitempty"`
+	Name    string            `json:"name,omitempty"`
+	Labels  map[string]string `json:"labels,omitempty"`
+	Started time.Time         `json:"started"`
+	Elapsed string            `json:"elapsed"`
+}
+
+type errorView struct {
+	Error string `json:"error"`
+}
+
+var (
+	errNotFound         = errors.New("admin: not found")
+	errMethodNotAllowed = errors.New("admin: method not allowed")
+	errNotSupported     = errors.New("admin: not supported by pool")
+	errPoolClosed       = errors.New("admin: pool has been closed")
+)
+
+// optional methods of pools, pools of pond implement all of them.
+type (
+	stateReporter interface {
+		State() pond.PoolState
+	}
+	capacityReporter interface {
+		Capacity() int
+	}
+	purgeDurationSetter interface {
+		SetPurgeDuration(dur time.Duration)
+	}
+)
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.auth != nil {
+		if err := h.auth(r); err != nil {
+			writeJSON(w, http.StatusForbidden, errorView{err.Error()})
+			return
+		}
+	}
+
+	path := strings.Trim(r.URL.Path, "/")
+	if path == "" {
+		if r.Method != http.MethodGet {
+			writeJSON(w, http.StatusMethodNotAllowed, errorView{errMethodNotAllowed.Error()})
+			return
+		}
+		infos := pond.Pools()
+		views := make([]PoolView, 0, len(infos))
+		for _, info := range infos {
+			if pool, ok := pond.Get(info.Name); ok {
+				views = append(views, h.view(info.Name, pool))
+			}
+		}
+		writeJSON(w, http.StatusOK, views)
+		return
+	}
+
+	parts := strings.Split(path, "/")
+	if parts[0] != "pools" || len(parts) < 2 || len(parts) > 3 {
+		writeJSON(w, http.StatusNotFound, errorView{errNotFound.Error()})
+		return
+	}
+	name := parts[1]
+	pool, ok := pond.Get(name)
+	if !ok {
+		writeJSON(w, http.StatusNotFound, errorView{errNotFound.Error()})
+		return
+	}
+
+	if len(parts) == 2 {
+		if r.Method != http.MethodGet {
+			writeJSON(w, http.StatusMethodNotAllowed, errorView{errMethodNotAllowed.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, h.view(name, pool))
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, errorView{errMethodNotAllowed.Error()})
+		return
+	}
+	// closed pools may be still registered, controlling them is a
+	// conflict, and pausing a paused pool is a no-op.
+	var state pond.PoolState
+	if reporter, ok := pool.(stateReporter); ok {
+		state = reporter.State()
+	}
+	if state == pond.PoolClosed {
+		writeJSON(w, http.StatusConflict, errorView{errPoolClosed.Error()})
+		return
+	}
+	switch parts[2] {
+	case "pause":
+		if state != pond.PoolPaused {
+			pool.Pause()
+		}
+	case "resume":
+		pool.Resume()
+	case "capacity":
+		capacity, err := strconv.Atoi(r.FormValue("capacity"))
+		if err != nil || capacity <= 0 {
+			writeJSON(w, http.StatusBadRequest, errorView{"admin: invalid capacity"})
+			return
+		}
+		pool.SetCapacity(capacity)
+	case "purge-duration":
+		dur, err := time.ParseDuration(r.FormValue("duration"))
+		if err != nil || dur <= 0 {
+			writeJSON(w, http.StatusBadRequest, errorView{"admin: invalid duration"})
+			return
+		}
+		setter, ok := pool.(purgeDurationSetter)
+		if !ok {
+			writeJSON(w, http.StatusNotImplemented, errorView{errNotSupported.Error()})
+			return
+		}
+		setter.SetPurgeDuration(dur)
+	default:
+		writeJSON(w, http.StatusNotFound, errorView{errNotFound.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, h.view(name, pool))
+}
+
+func (h *Handler) view(name string, pool pond.ManagedPool) PoolView {
+	var stats pond.Stats
+	if reporter, ok := pool.(pond.StatsReporter); ok {
+		stats = reporter.Stats()
+	}
+	var running []pond.RunningTask
+	if inspector, ok := pool.(pond.TaskInspector); ok {
+		running = inspector.RunningTasks()
+	}
+	if len(running) > h.maxRunning {
+		running = running[:h.maxRunning]
+	}
+	tasks := make([]TaskView, 0, len(running))
+	for _, task := range running {
+		tasks = append(tasks, TaskView{ID: task.ID, Name: task.Name, Labels: task.Labels, Started: task.Started, Elapsed: task.Elapsed.String()})
+	}
+	view := PoolView{
+		Name:           name,
+		Workers:        pool.Workers(),
+		Queued:         stats.Queued,
+		Stats:          stats,
+		LongestRunning: tasks,
+	}
+	if reporter, ok := pool.(stateReporter); ok {
+		view.State = reporter.State().String()
+	}
+	if reporter, ok := pool.(capacityReporter); ok {
+		view.Capacity = reporter.Capacity()
+	}
+	return view
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
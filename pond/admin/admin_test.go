@@ -0,0 +1,172 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"pond/pond"
+)
+
+func decode(t *testing.T, resp *http.Response, v interface{}) {
+	t.Helper()
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Error("response should be JSON:", err)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	fmt.Println(t.Name())
+	defer pond.CloseAll(context.Background())
+	p := pond.NewPoolWithOptions(pond.WithCapacity(2), pond.WithRunningTasks())
+	if err := pond.Register("p", p); err != nil {
+		t.Error("pool should be registered:", err)
+	}
+	release := make(chan struct{})
+	started := make(chan struct{})
+	future, _ := p.Submit(func() (interface{}, error) {
+		close(started)
+		<-release
+		return nil, nil
+	})
+	<-started
+
+	srv := httptest.NewServer(NewHandler())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Error("pools should be listed:", err)
+		return
+	}
+	var views []PoolView
+	decode(t, resp, &views)
+	if len(views) != 1 || views[0].Name != "p" || views[0].State != "running" || views[0].Capacity != 2 {
+		t.Errorf("registered pool should be listed, got %+v", views)
+	} else if len(views[0].LongestRunning) != 1 || views[0].Stats.Running != 1 {
+		t.Errorf("running task should be shown, got %+v", views[0])
+	}
+	close(release)
+	_, _ = future.Value()
+
+	post := func(path string, form url.Values) (int, PoolView) {
+		var view PoolView
+		resp, err := http.PostForm(srv.URL+path, form)
+		if err != nil {
+			t.Error("request should be served:", err)
+			return 0, view
+		}
+		if resp.StatusCode == http.StatusOK {
+			decode(t, resp, &view)
+		} else {
+			resp.Body.Close()
+		}
+		return resp.StatusCode, view
+	}
+
+	if code, view := post("/pools/p/pause", nil); code != http.StatusOK || view.State != "paused" {
+		t.Errorf("pool should be paused, got %d %+v", code, view)
+	}
+	if code, view := post("/pools/p/pause", nil); code != http.StatusOK || view.State != "paused" {
+		t.Errorf("pausing paused pool should be a no-op, got %d %+v", code, view)
+	}
+	if code, view := post("/pools/p/resume", nil); code != http.StatusOK || view.State != "running" {
+		t.Errorf("pool should be resumed, got %d %+v", code, view)
+	}
+	if code, view := post("/pools/p/capacity", url.Values{"capacity": {"4"}}); code != http.StatusOK || view.Capacity != 4 {
+		t.Errorf("capacity of pool should be set, got %d %+v", code, view)
+	}
+	if code, _ := post("/pools/p/purge-duration", url.Values{"duration": {"1s"}}); code != http.StatusOK {
+		t.Errorf("purge duration of pool should be set, got %d", code)
+	}
+	if code, _ := post("/pools/p/capacity", url.Values{"capacity": {"x"}}); code != http.StatusBadRequest {
+		t.Errorf("invalid capacity should be rejected, got %d", code)
+	}
+	if code, _ := post("/pools/q/pause", nil); code != http.StatusNotFound {
+		t.Errorf("pool not registered should not be found, got %d", code)
+	}
+
+	closed := pond.NewPool(1)
+	closed.Close()
+	if err := pond.Register("closed", closed); err != nil {
+		t.Error("pool should be registered:", err)
+	}
+	if code, _ := post("/pools/closed/pause", nil); code != http.StatusConflict {
+		t.Errorf("closed pool should not be controlled, got %d", code)
+	}
+	// closed pool must not be closed again by CloseAll.
+	pond.Unregister("closed")
+
+	resp, err = http.Get(srv.URL + "/pools/p/pause")
+	if err != nil {
+		t.Error("request should be served:", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("controlling pool by GET should not be allowed, got %d", resp.StatusCode)
+	}
+}
+
+// minimalPool implements pond.ManagedPool only.
+type minimalPool struct {
+	pond.ManagedPool
+}
+
+func (p minimalPool) Workers() int {
+	return 1
+}
+
+func TestHandlerMinimalPool(t *testing.T) {
+	fmt.Println(t.Name())
+	if err := pond.Register("minimal", minimalPool{}); err != nil {
+		t.Error("pool should be registered:", err)
+	}
+	defer pond.Unregister("minimal")
+	h := NewHandler()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/pools/minimal", nil))
+	var view PoolView
+	if err := json.NewDecoder(rec.Body).Decode(&view); err != nil || view.Workers != 1 || view.State != "" {
+		t.Errorf("pool without optional methods should be shown, got %+v", view)
+	}
+
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/pools/minimal/purge-duration", nil)
+	req.Form = url.Values{"duration": {"1s"}}
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotImplemented {
+		t.Errorf("setting purge duration should not be supported, got %d", rec.Code)
+	}
+}
+
+func TestHandlerAuth(t *testing.T) {
+	fmt.Println(t.Name())
+	h := NewHandler(WithAuth(func(r *http.Request) error {
+		if r.Header.Get("Authorization") != "token" {
+			return errors.New("unauthorized")
+		}
+		return nil
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("request without token should be forbidden, got %d", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "token")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("request with token should be served, got %d", rec.Code)
+	}
+}
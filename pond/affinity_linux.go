@@ -0,0 +1,51 @@
+//go:build linux
+// +build linux
+
+package pond
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// cpuMask is the cpu set used by sched_setaffinity(2), up to 1024 cpus.
+type cpuMask [1024 / 64]uint64
+
+func (m *cpuMask) set(cpu int) {
+	m[cpu/64] |= 1 << (uint(cpu) % 64)
+}
+
+func (m *cpuMask) isSet(cpu int) bool {
+	return m[cpu/64]&(1<<(uint(cpu)%64)) != 0
+}
+
+func schedAffinity(trap uintptr, m *cpuMask) error {
+	// pid 0 means the calling thread.
+	_, _, errno := syscall.RawSyscall(trap, 0, unsafe.Sizeof(*m), uintptr(unsafe.Pointer(m)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// pinThread pin the calling OS thread to cpus and return a function to
+// restore its previous cpu set. Caller must have locked the goroutine to
+// current thread.
+func pinThread(cpus []int) (restore func() error, err error) {
+	var old, mask cpuMask
+	if err := schedAffinity(syscall.SYS_SCHED_GETAFFINITY, &old); err != nil {
+		return nil, err
+	}
+	for _, cpu := range cpus {
+		if cpu < 0 || cpu >= len(mask)*64 {
+			return nil, ErrInvalidCPU
+		}
+		mask.set(cpu)
+	}
+	if err := schedAffinity(syscall.SYS_SCHED_SETAFFINITY, &mask); err != nil {
+		return nil, err
+	}
+	return func() error {
+		return schedAffinity(syscall.SYS_SCHED_SETAFFINITY, &old)
+	}, nil
+}
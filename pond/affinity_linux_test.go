@@ -0,0 +1,55 @@
+//go:build linux
+// +build linux
+
+package pond
+
+import (
+	"fmt"
+	"runtime"
+	"syscall"
+	"testing"
+)
+
+func TestPinThread(t *testing.T) {
+	fmt.Println(t.Name())
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	var before, pinned, after cpuMask
+	_ = schedAffinity(syscall.SYS_SCHED_GETAFFINITY, &before)
+	restore, err := pinThread([]int{0})
+	if err != nil {
+		t.Skip("sched_setaffinity not permitted:", err)
+	}
+	_ = schedAffinity(syscall.SYS_SCHED_GETAFFINITY, &pinned)
+	if !pinned.isSet(0) || pinned != (cpuMask{1}) {
+		t.Error("thread should be pinned to cpu 0 only")
+	}
+	if err := restore(); err != nil {
+		t.Error("restore affinity failed:", err)
+	}
+	_ = schedAffinity(syscall.SYS_SCHED_GETAFFINITY, &after)
+	if after != before {
+		t.Error("thread affinity should be restored")
+	}
+	if _, err := pinThread([]int{-1}); err != ErrInvalidCPU {
+		t.Error("negative cpu should be rejected")
+	}
+}
+
+func TestBasicPoolLockOSThreadInit(t *testing.T) {
+	fmt.Println(t.Name())
+	pool := NewPoolWithOptions(WithCapacity(1), WithLockOSThread(), WithWorkerState(
+		func() (interface{}, error) { return syscall.Gettid(), nil }, nil,
+	))
+	for i := 0; i < 4; i++ {
+		future, _ := pool.(StatefulSubmitter).SubmitWithState(func(state interface{}) (interface{}, error) {
+			runtime.Gosched()
+			return state == syscall.Gettid(), nil
+		})
+		if same, _ := future.Value(); same != true {
+			t.Error("worker state should be initialized on the locked thread")
+		}
+	}
+	pool.Close()
+}
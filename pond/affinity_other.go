@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package pond
+
+// pinThread is only supported on linux.
+func pinThread(cpus []int) (restore func() error, err error) {
+	return nil, ErrAffinityUnsupported
+}
@@ -0,0 +1,246 @@
+package pond
+
+import (
+	"sync"
+	"time"
+)
+
+// BreakerState is the state of circuit breaker.
+type BreakerState int32
+
+const (
+	// BreakerClosed let all calls pass and count failures.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen reject all calls until cooldown elapsed.
+	BreakerOpen
+	// BreakerHalfOpen let limited probe calls pass, breaker is closed if
+	// all of them succeed, otherwise open again.
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// BreakerConfig configures the circuit breaker around fixed function of
+// FixedFuncPool, zero values of thresholds disable them.
+type BreakerConfig struct {
+	// ConsecutiveFailures trip breaker when this many calls fail in a row.
+	ConsecutiveFailures int
+
+	// FailureRatio trip breaker when ratio of failed calls reaches it,
+	// once there are at least MinRequests calls counted.
+	FailureRatio float64
+	MinRequests  int
+
+	// Interval reset the counts periodically in closed state, 0 means
+	// counts are only reset when state changed.
+	Interval time.Duration
+
+	// Cooldown is the duration breaker keeps open before half-open,
+	// default is defaultBreakerCooldown.
+	Cooldown time.Duration
+
+	// HalfOpenProbes is the number of calls let pass in half-open state,
+	// default is 1.
+	HalfOpenProbes int
+
+	// OnStateChange is invoked synchronously after state changed, locks
+	// of breaker are not held, so it can query state of breaker.
+	OnStateChange func(from, to BreakerState)
+
+	// IsFailure judge whether a call failed by its error, default is
+	// err != nil.
+	IsFailure func(err error) bool
+}
+
+// circuitBreaker guard calls by failure statistics, every state change
+// starts a new generation, results of calls admitted in older ones are
+// ignored.
+type circuitBreaker struct {
+	cfg   BreakerConfig
+	clock Clock
+
+	mu          sync.Mutex
+	state       BreakerState
+	generation  uint64
+	expiry      time.Time
+	requests    int
+	failures    int
+	consecutive int
+	probes      int
+	successes   int
+
+	// changes are state changes not reported to OnStateChange yet.
+	changes []stateChange
+}
+
+type stateChange struct {
+	from, to BreakerState
+}
+
+func newCircuitBreaker(cfg BreakerConfig, clock Clock) *circuitBreaker {
+	if cfg.Cooldown <= 0 {
+		cfg.Cooldown = defaultBreakerCooldown
+	}
+	if cfg.HalfOpenProbes <= 0 {
+		cfg.HalfOpenProbes = 1
+	}
+	if cfg.IsFailure == nil {
+		cfg.IsFailure = func(err error) bool { return err != nil }
+	}
+	b := &circuitBreaker{cfg: cfg, clock: clock}
+	b.setState(BreakerClosed, clock.Now())
+	return b
+}
+
+func (b *circuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.unlock()
+	b.refresh(b.clock.Now())
+	return b.state
+}
+
+// allow admit a call and return its generation, ErrCircuitOpen returned
+// if breaker is open or half-open probes are used up.
+func (b *circuitBreaker) allow() (uint64, error) {
+	b.mu.Lock()
+	defer b.unlock()
+	b.refresh(b.clock.Now())
+
+	switch b.state {
+	case BreakerOpen:
+		return 0, ErrCircuitOpen
+	case BreakerHalfOpen:
+		if b.probes >= b.cfg.HalfOpenProbes {
+			return 0, ErrCircuitOpen
+		}
+		b.probes++
+	}
+	return b.generation, nil
+}
+
+// admit report whether a call admitted in generation gen can execute
+// right now, it is checked again before execution because breaker may
+// trip while call queued. Calls admitted before breaker half-open are
+// rejected, so that only probes run in half-open state.
+func (b *circuitBreaker) admit(gen uint64) bool {
+	b.mu.Lock()
+	defer b.unlock()
+	b.refresh(b.clock.Now())
+	switch b.state {
+	case BreakerOpen:
+		return false
+	case BreakerHalfOpen:
+		return gen == b.generation
+	}
+	return true
+}
+
+// cancel give back the admission of a call which is not executed.
+func (b *circuitBreaker) cancel(gen uint64) {
+	b.mu.Lock()
+	defer b.unlock()
+	if gen == b.generation && b.state == BreakerHalfOpen {
+		b.probes--
+	}
+}
+
+// record count the result of a call admitted in generation gen.
+func (b *circuitBreaker) record(gen uint64, err error) {
+	b.mu.Lock()
+	defer b.unlock()
+	now := b.clock.Now()
+	b.refresh(now)
+	if gen != b.generation {
+		return
+	}
+
+	failed := b.cfg.IsFailure(err)
+	switch b.state {
+	case BreakerClosed:
+		b.requests++
+		if failed {
+			b.failures++
+			b.consecutive++
+		} else {
+			b.consecutive = 0
+		}
+		if b.tripped() {
+			b.setState(BreakerOpen, now)
+		}
+	case BreakerHalfOpen:
+		if failed {
+			b.setState(BreakerOpen, now)
+			return
+		}
+		b.successes++
+		if b.successes >= b.cfg.HalfOpenProbes {
+			b.setState(BreakerClosed, now)
+		}
+	}
+}
+
+func (b *circuitBreaker) tripped() bool {
+	if b.cfg.ConsecutiveFailures > 0 && b.consecutive >= b.cfg.ConsecutiveFailures {
+		return true
+	}
+	return b.cfg.FailureRatio > 0 && b.requests >= b.cfg.MinRequests &&
+		float64(b.failures)/float64(b.requests) >= b.cfg.FailureRatio
+}
+
+// refresh move breaker forward by time, caller should hold the lock.
+func (b *circuitBreaker) refresh(now time.Time) {
+	if b.expiry.IsZero() || now.Before(b.expiry) {
+		return
+	}
+	switch b.state {
+	case BreakerClosed:
+		// start a new counting interval.
+		b.setState(BreakerClosed, now)
+	case BreakerOpen:
+		b.setState(BreakerHalfOpen, now)
+	}
+}
+
+// setState switch state and reset counts, caller should hold the lock.
+func (b *circuitBreaker) setState(state BreakerState, now time.Time) {
+	from := b.state
+	b.state = state
+	b.generation++
+	b.requests, b.failures, b.consecutive = 0, 0, 0
+	b.probes, b.successes = 0, 0
+
+	b.expiry = time.Time{}
+	switch state {
+	case BreakerClosed:
+		if b.cfg.Interval > 0 {
+			b.expiry = now.Add(b.cfg.Interval)
+		}
+	case BreakerOpen:
+		b.expiry = now.Add(b.cfg.Cooldown)
+	}
+
+	if from != state && b.cfg.OnStateChange != nil {
+		b.changes = append(b.changes, stateChange{from, state})
+	}
+}
+
+// unlock release the lock, and report state changes made under it to
+// OnStateChange.
+func (b *circuitBreaker) unlock() {
+	changes := b.changes
+	b.changes = nil
+	b.mu.Unlock()
+	for _, change := range changes {
+		b.cfg.OnStateChange(change.from, change.to)
+	}
+}
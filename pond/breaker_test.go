@@ -0,0 +1,129 @@
+package pond
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerStates(t *testing.T) {
+	fmt.Println(t.Name())
+	var changes []string
+	clock := &fakeClock{}
+	b := newCircuitBreaker(BreakerConfig{
+		ConsecutiveFailures: 2,
+		Cooldown:            time.Second,
+		OnStateChange: func(from, to BreakerState) {
+			changes = append(changes, from.String()+"->"+to.String())
+		},
+	}, clock)
+	failure := errors.New("failure")
+
+	for i := 0; i < 2; i++ {
+		gen, _ := b.allow()
+		b.record(gen, failure)
+	}
+	if _, err := b.allow(); err != ErrCircuitOpen {
+		t.Error("breaker should be open after consecutive failures")
+	}
+
+	clock.advance(time.Second)
+	gen, err := b.allow()
+	if err != nil || b.State() != BreakerHalfOpen {
+		t.Error("breaker should let probe pass after cooldown")
+	}
+	if _, err := b.allow(); err != ErrCircuitOpen {
+		t.Error("breaker should only let one probe pass")
+	}
+	b.record(gen, nil)
+	if b.State() != BreakerClosed {
+		t.Error("breaker should be closed after probe succeeded")
+	}
+	if fmt.Sprint(changes) != "[closed->open open->half-open half-open->closed]" {
+		t.Errorf("state changes should be reported, got %v", changes)
+	}
+}
+
+func TestCircuitBreakerFailureRatio(t *testing.T) {
+	fmt.Println(t.Name())
+	b := newCircuitBreaker(BreakerConfig{FailureRatio: 0.5, MinRequests: 4}, &fakeClock{})
+	results := []error{nil, errors.New("failure"), nil, errors.New("failure")}
+	for i, err := range results {
+		if b.State() != BreakerClosed {
+			t.Errorf("breaker should be closed before %d calls", i+1)
+		}
+		gen, _ := b.allow()
+		b.record(gen, err)
+	}
+	if b.State() != BreakerOpen {
+		t.Error("breaker should be open when failure ratio reached")
+	}
+}
+
+func TestFixedFuncPoolCircuitBreaker(t *testing.T) {
+	fmt.Println(t.Name())
+	pool := NewFixedFuncPoolWithOptions(func(interface{}) (interface{}, error) {
+		return nil, errors.New("downstream failure")
+	}, WithCapacity(1), WithCircuitBreaker(BreakerConfig{ConsecutiveFailures: 1, Cooldown: time.Hour}))
+	future, _ := pool.Submit(1)
+	_, _ = future.Value()
+	if pool.BreakerState() != BreakerOpen {
+		t.Error("breaker should be open after failure")
+	}
+	if _, err := pool.Submit(2); err != ErrCircuitOpen {
+		t.Error("submit should fail fast when breaker is open")
+	}
+	pool.Close()
+}
+
+func TestCircuitBreakerHalfOpenAdmit(t *testing.T) {
+	fmt.Println(t.Name())
+	clock := &fakeClock{}
+	var b *circuitBreaker
+	b = newCircuitBreaker(BreakerConfig{
+		ConsecutiveFailures: 1,
+		Cooldown:            time.Second,
+		OnStateChange: func(from, to BreakerState) {
+			// callback is invoked without locks held.
+			_ = b.State()
+		},
+	}, clock)
+	queued, _ := b.allow()
+	gen, _ := b.allow()
+	b.record(gen, errors.New("failure"))
+	clock.advance(time.Second)
+	probe, err := b.allow()
+	if err != nil || b.State() != BreakerHalfOpen {
+		t.Error("breaker should let probe pass after cooldown")
+	}
+	if b.admit(queued) {
+		t.Error("call admitted before half-open should be rejected")
+	}
+	if !b.admit(probe) {
+		t.Error("probe should be admitted in half-open state")
+	}
+}
+
+func TestFixedFuncPoolCircuitBreakerPanic(t *testing.T) {
+	fmt.Println(t.Name())
+	clock := &fakeClock{}
+	pool := NewFixedFuncPoolWithOptions(func(interface{}) (interface{}, error) {
+		panic("downstream panic")
+	}, WithCapacity(1), WithClock(clock), WithMiddleware(RecoveryMiddleware()),
+		WithCircuitBreaker(BreakerConfig{ConsecutiveFailures: 1, Cooldown: time.Second}))
+	future, _ := pool.Submit(1)
+	if _, err := future.Value(); !errors.Is(err, ErrTaskPanicked) {
+		t.Error("panic should be recovered by middleware")
+	}
+	if pool.BreakerState() != BreakerOpen {
+		t.Error("panicking call should be recorded as failure")
+	}
+	clock.advance(time.Second)
+	future, _ = pool.Submit(2)
+	_, _ = future.Value()
+	if pool.BreakerState() != BreakerOpen {
+		t.Error("panicking probe should open breaker again")
+	}
+	pool.Close()
+}
@@ -0,0 +1,131 @@
+package pond
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// CacheConfig configures the result cache of FixedFuncPool.
+type CacheConfig struct {
+	// Key compute the cache key of argument, default is fmt.Sprint(arg).
+	Key func(arg interface{}) string
+
+	// Size is the max number of cached results, least recently used
+	// ones are evicted, default is defaultCacheSize.
+	Size int
+
+	// TTL is the duration a successful result cached, 0 means forever.
+	TTL time.Duration
+
+	// NegativeTTL is the duration an error result cached, 0 means errors
+	// are not cached. ErrCircuitOpen and ErrPoolClosed are never cached.
+	NegativeTTL time.Duration
+}
+
+// resultCache is a size-bounded LRU cache of call results with expiry,
+// every purge starts a new generation, results of calls submitted in
+// older ones are dropped.
+type resultCache struct {
+	cfg   CacheConfig
+	clock Clock
+
+	mu         sync.Mutex
+	lru        *list.List
+	entries    map[string]*list.Element
+	generation uint64
+}
+
+type cacheEntry struct {
+	key     string
+	val     interface{}
+	err     error
+	version uint64
+	expiry  time.Time
+}
+
+func newResultCache(cfg CacheConfig, clock Clock) *resultCache {
+	if cfg.Key == nil {
+		cfg.Key = func(arg interface{}) string { return fmt.Sprint(arg) }
+	}
+	if cfg.Size <= 0 {
+		cfg.Size = defaultCacheSize
+	}
+	return &resultCache{
+		cfg:     cfg,
+		clock:   clock,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// get return the cached result of key, ok is false if missed or expired.
+func (c *resultCache) get(key string) (*cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if !entry.expiry.IsZero() && !c.clock.Now().Before(entry.expiry) {
+		c.lru.Remove(elem)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	return entry, true
+}
+
+// setter return a function caching the result of key with the version of
+// fixed function served it, it is a no-op if cache purged after setter
+// created.
+func (c *resultCache) setter(key string) func(version uint64, val interface{}, err error) {
+	c.mu.Lock()
+	gen := c.generation
+	c.mu.Unlock()
+
+	return func(version uint64, val interface{}, err error) {
+		ttl := c.cfg.TTL
+		if err != nil {
+			// errors of pool instead of the call are never cached.
+			if c.cfg.NegativeTTL <= 0 || errors.Is(err, ErrCircuitOpen) || errors.Is(err, ErrPoolClosed) {
+				return
+			}
+			ttl = c.cfg.NegativeTTL
+		}
+		entry := &cacheEntry{key: key, val: val, err: err, version: version}
+		if ttl > 0 {
+			entry.expiry = c.clock.Now().Add(ttl)
+		}
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if gen != c.generation {
+			return
+		}
+		if elem, ok := c.entries[key]; ok {
+			elem.Value = entry
+			c.lru.MoveToFront(elem)
+			return
+		}
+		c.entries[key] = c.lru.PushFront(entry)
+		for c.lru.Len() > c.cfg.Size {
+			oldest := c.lru.Back()
+			c.lru.Remove(oldest)
+			delete(c.entries, oldest.Value.(*cacheEntry).key)
+		}
+	}
+}
+
+// purge drop all cached results.
+func (c *resultCache) purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	c.lru.Init()
+	c.entries = make(map[string]*list.Element)
+}
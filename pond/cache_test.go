@@ -0,0 +1,82 @@
+package pond
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestResultCache(t *testing.T) {
+	fmt.Println(t.Name())
+	clock := &fakeClock{}
+	c := newResultCache(CacheConfig{Size: 2, TTL: time.Second, NegativeTTL: time.Millisecond}, clock)
+
+	c.setter("a")(1, 1, nil)
+	c.setter("b")(1, 2, nil)
+	_, _ = c.get("a")
+	c.setter("c")(1, 3, nil)
+	if _, ok := c.get("b"); ok {
+		t.Error("least recently used result should be evicted")
+	}
+	if entry, ok := c.get("a"); !ok || entry.val != 1 {
+		t.Error("recently used result should be kept")
+	}
+
+	c.setter("e")(1, nil, errors.New("failure"))
+	if entry, ok := c.get("e"); !ok || entry.err == nil {
+		t.Error("error result should be cached")
+	}
+	c.setter("o")(1, nil, ErrCircuitOpen)
+	if _, ok := c.get("o"); ok {
+		t.Error("rejection of circuit breaker should not be cached")
+	}
+	clock.advance(time.Millisecond)
+	if _, ok := c.get("e"); ok {
+		t.Error("error result should expire after negative ttl")
+	}
+	clock.advance(time.Second)
+	if _, ok := c.get("a"); ok {
+		t.Error("result should expire after ttl")
+	}
+
+	set := c.setter("a")
+	c.purge()
+	set(1, 1, nil)
+	if _, ok := c.get("a"); ok {
+		t.Error("result of call submitted before purge should be dropped")
+	}
+}
+
+func TestFixedFuncPoolResultCache(t *testing.T) {
+	fmt.Println(t.Name())
+	var calls int32
+	pool := NewFixedFuncPoolWithOptions(func(arg interface{}) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		return fooPow(arg)
+	}, WithCapacity(1), WithResultCache(CacheConfig{}))
+
+	for i := 0; i < 3; i++ {
+		future, _ := pool.Submit(2)
+		if val, _ := future.Value(); val != 4 {
+			t.Error("execution result should be 4!")
+		}
+	}
+	if atomic.LoadInt32(&calls) != 1 {
+		t.Error("cached result should be returned without calling")
+	}
+	if stats := pool.Stats(); stats.CacheHits != 2 || stats.CacheMisses != 1 {
+		t.Errorf("cache lookups should be counted, got %+v", stats)
+	}
+
+	pool.SetNewFixedFunc(func(num interface{}) (interface{}, error) {
+		n := num.(int)
+		return n * n * n, nil
+	})
+	future, _ := pool.Submit(2)
+	if val, _ := future.Value(); val != 8 {
+		t.Error("cache should be invalidated when fixed function replaced")
+	}
+	pool.Close()
+}
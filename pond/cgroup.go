@@ -0,0 +1,177 @@
+package pond
+
+import (
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// cgroupRoot is the mount point of cgroup filesystem, and procCgroup
+// lists cgroups of current process.
+const (
+	cgroupRoot = "/sys/fs/cgroup"
+	procCgroup = "/proc/self/cgroup"
+)
+
+var (
+	detectedCapacity int
+	detectOnce       sync.Once
+
+	// overriddenCapacity is set by SetDefaultCapacity, 0 means not set.
+	overriddenCapacity int64
+)
+
+// DefaultCapacity return the capacity of pools created without explicit
+// capacity. It is defaultPoolCapacityFactor times the cpu quota of current
+// cgroup (v1 or v2), or NumCPU if no quota set, and bounded by the cgroup
+// memory limit, so that pools are not oversized in containers.
+func DefaultCapacity() int {
+	if cap := atomic.LoadInt64(&overriddenCapacity); cap > 0 {
+		return int(cap)
+	}
+	detectOnce.Do(func() {
+		detectedCapacity = detectCapacity(cgroupRoot, cgroupPaths(procCgroup))
+	})
+	return detectedCapacity
+}
+
+// SetDefaultCapacity override the detected default capacity for pools
+// created afterwards, a non-positive cap restores the detected one.
+func SetDefaultCapacity(cap int) {
+	if cap < 0 {
+		cap = 0
+	}
+	atomic.StoreInt64(&overriddenCapacity, int64(cap))
+}
+
+// detectCapacity compute default capacity by cgroup files under root,
+// paths are cgroups of current process returned by cgroupPaths.
+func detectCapacity(root string, paths map[string]string) int {
+	cpus := float64(runtime.NumCPU())
+	if quota, ok := cgroupCPUQuota(root, paths); ok && quota < cpus {
+		cpus = quota
+	}
+	cap := int(math.Ceil(cpus * defaultPoolCapacityFactor))
+	if limit, ok := cgroupMemoryLimit(root, paths); ok {
+		if n := int(limit / defaultWorkerMemoryBudget); n < cap {
+			cap = n
+		}
+	}
+	if cap < 1 {
+		cap = 1
+	}
+	return cap
+}
+
+// cgroupPaths parse cgroups of current process from file formatted as
+// /proc/self/cgroup, and return cgroup paths by controllers, the path of
+// cgroup v2 is keyed by "".
+func cgroupPaths(file string) map[string]string {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil
+	}
+	paths := make(map[string]string)
+	for _, line := range strings.Split(string(content), "\n") {
+		// "$ID:$CONTROLLERS:$PATH", $CONTROLLERS is empty for v2.
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		for _, controller := range strings.Split(parts[1], ",") {
+			paths[controller] = parts[2]
+		}
+	}
+	return paths
+}
+
+// cgroupDirs return directories of cgroup path and all its ancestors in
+// hierarchy mounted at mount, limits of them all apply. Path may not
+// exist under mount without cgroup namespace, the mount itself is the
+// cgroup of process then.
+func cgroupDirs(mount, path string) []string {
+	var dirs []string
+	for p := filepath.Clean("/" + path); ; p = filepath.Dir(p) {
+		dirs = append(dirs, filepath.Join(mount, p))
+		if p == "/" {
+			return dirs
+		}
+	}
+}
+
+// cgroupCPUQuota return cpu quota in cores, ok is false if not limited.
+func cgroupCPUQuota(root string, paths map[string]string) (quota float64, ok bool) {
+	limit := func(q float64, limited bool) {
+		if limited && (!ok || q < quota) {
+			quota, ok = q, true
+		}
+	}
+	// cgroup v2: "$MAX $PERIOD", $MAX is "max" if not limited.
+	for _, dir := range cgroupDirs(root, paths[""]) {
+		if fields := readCgroupFields(dir, "cpu.max"); len(fields) == 2 {
+			limit(cpuQuota(fields[0], fields[1]))
+		}
+	}
+	// cgroup v1: quota is -1 if not limited.
+	for _, mount := range []string{"cpu", "cpu,cpuacct"} {
+		for _, dir := range cgroupDirs(filepath.Join(root, mount), paths["cpu"]) {
+			quota := readCgroupFields(dir, "cpu.cfs_quota_us")
+			period := readCgroupFields(dir, "cpu.cfs_period_us")
+			if len(quota) == 1 && len(period) == 1 {
+				limit(cpuQuota(quota[0], period[0]))
+			}
+		}
+	}
+	return quota, ok
+}
+
+func cpuQuota(quota, period string) (float64, bool) {
+	q, err := strconv.ParseInt(quota, 10, 64)
+	if err != nil || q <= 0 {
+		return 0, false
+	}
+	p, err := strconv.ParseInt(period, 10, 64)
+	if err != nil || p <= 0 {
+		return 0, false
+	}
+	return float64(q) / float64(p), true
+}
+
+// cgroupMemoryLimit return memory limit in bytes, ok is false if not limited.
+func cgroupMemoryLimit(root string, paths map[string]string) (limit int64, ok bool) {
+	read := func(dir, file string) {
+		fields := readCgroupFields(dir, file)
+		if len(fields) != 1 {
+			return
+		}
+		l, err := strconv.ParseInt(fields[0], 10, 64)
+		// v2 writes "max" and v1 writes a huge page-aligned number if
+		// not limited.
+		if err != nil || l <= 0 || l >= 1<<62 {
+			return
+		}
+		if !ok || l < limit {
+			limit, ok = l, true
+		}
+	}
+	for _, dir := range cgroupDirs(root, paths[""]) {
+		read(dir, "memory.max")
+	}
+	for _, dir := range cgroupDirs(filepath.Join(root, "memory"), paths["memory"]) {
+		read(dir, "memory.limit_in_bytes")
+	}
+	return limit, ok
+}
+
+func readCgroupFields(root, file string) []string {
+	content, err := ioutil.ReadFile(filepath.Join(root, file))
+	if err != nil {
+		return nil
+	}
+	return strings.Fields(string(content))
+}
@@ -0,0 +1,90 @@
+package pond
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func writeCgroupFiles(t *testing.T, files map[string]string) string {
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		_ = os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestDetectCapacity(t *testing.T) {
+	fmt.Println(t.Name())
+	unlimited := defaultPoolCapacityFactor * runtime.NumCPU()
+	cases := []struct {
+		name  string
+		paths map[string]string
+		files map[string]string
+		want  int
+	}{
+		{"none", nil, nil, unlimited},
+		{"v2 unlimited", nil, map[string]string{"cpu.max": "max 100000\n", "memory.max": "max\n"}, unlimited},
+		{"v2 half core", nil, map[string]string{"cpu.max": "50000 100000\n"}, defaultPoolCapacityFactor / 2},
+		{"v2 memory", nil, map[string]string{"cpu.max": "50000 100000\n", "memory.max": "3145728\n"}, 3},
+		{"v2 nested", map[string]string{"": "/app/svc"}, map[string]string{
+			"cpu.max":         "max 100000\n",
+			"app/svc/cpu.max": "50000 100000\n",
+		}, defaultPoolCapacityFactor / 2},
+		{"v2 ancestor", map[string]string{"": "/app/svc"}, map[string]string{
+			"app/cpu.max":     "25000 100000\n",
+			"app/svc/cpu.max": "max 100000\n",
+		}, defaultPoolCapacityFactor / 4},
+		{"v1 quota", nil, map[string]string{
+			"cpu,cpuacct/cpu.cfs_quota_us":  "50000\n",
+			"cpu,cpuacct/cpu.cfs_period_us": "100000\n",
+		}, defaultPoolCapacityFactor / 2},
+		{"v1 nested", map[string]string{"cpu": "/docker/x", "memory": "/docker/x"}, map[string]string{
+			"cpu,cpuacct/docker/x/cpu.cfs_quota_us":  "50000\n",
+			"cpu,cpuacct/docker/x/cpu.cfs_period_us": "100000\n",
+			"memory/docker/x/memory.limit_in_bytes":  "3145728\n",
+		}, 3},
+		{"v1 unlimited", nil, map[string]string{
+			"cpu/cpu.cfs_quota_us":         "-1\n",
+			"cpu/cpu.cfs_period_us":        "100000\n",
+			"memory/memory.limit_in_bytes": "9223372036854771712\n",
+		}, unlimited},
+		{"v1 tiny memory", nil, map[string]string{"memory/memory.limit_in_bytes": "1024\n"}, 1},
+	}
+	for _, c := range cases {
+		root := writeCgroupFiles(t, c.files)
+		if got := detectCapacity(root, c.paths); got != c.want {
+			t.Errorf("%s: capacity should be %d, got %d", c.name, c.want, got)
+		}
+	}
+}
+
+func TestCgroupPaths(t *testing.T) {
+	fmt.Println(t.Name())
+	root := writeCgroupFiles(t, map[string]string{"cgroup": "12:memory:/docker/x\n4:cpu,cpuacct:/docker/y\n0::/app\n"})
+	paths := cgroupPaths(filepath.Join(root, "cgroup"))
+	if paths["memory"] != "/docker/x" || paths["cpu"] != "/docker/y" || paths["cpuacct"] != "/docker/y" || paths[""] != "/app" {
+		t.Errorf("cgroup paths should be parsed by controllers, got %v", paths)
+	}
+}
+
+func TestSetDefaultCapacity(t *testing.T) {
+	fmt.Println(t.Name())
+	SetDefaultCapacity(3)
+	pool := NewPool()
+	if pool.Workers() != 3 {
+		t.Error("pool should be created with overridden default capacity")
+	}
+	pool.Close()
+	SetDefaultCapacity(0)
+	if DefaultCapacity() != detectCapacity(cgroupRoot, cgroupPaths(procCgroup)) {
+		t.Error("default capacity should be restored to detected one")
+	}
+}
@@ -0,0 +1,15 @@
+package pond
+
+import "time"
+
+// Clock tells the current time, it is injectable so that time-driven
+// behaviors of pool can be tested deterministically.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
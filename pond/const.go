@@ -9,6 +9,42 @@ var (
 	ErrPoolClosed  = errors.New("pool: pool has been closed, no more tasks submitted")
 	ErrPoolPaused  = errors.New("pool: pool has been paused, resume first please")
 	ErrTaskTimeout = errors.New("task: task timeout")
+
+	ErrTaskPanicked = errors.New("task: task panicked")
+	ErrTaskDeadline = errors.New("task: task deadline exceeded")
+
+	ErrTaskCost = errors.New("task: task cost is less than one or exceeds burst of rate limit")
+
+	ErrTaskExists    = errors.New("task: task with the same id exists")
+	ErrTaskNotFound  = errors.New("task: task not found")
+	ErrTaskRunning   = errors.New("task: task is running and can not be cancelled")
+	ErrTaskFinished  = errors.New("task: task has finished")
+	ErrTaskCancelled = errors.New("task: task cancelled")
+
+	ErrPoolRegistered  = errors.New("pool: pool with the same name registered")
+	ErrPoolNil         = errors.New("pool: pool is nil")
+	ErrDefaultPool     = errors.New("pool: default pool must accept tasks")
+	ErrSubPoolExists   = errors.New("pool: sub-pool with the same name exists")
+	ErrTenantQueueFull = errors.New("pool: queue of tenant is full")
+
+	ErrCircuitOpen = errors.New("pool: circuit breaker is open, call rejected")
+
+	ErrDurableDisabled = errors.New("pool: durable queue is not enabled")
+	ErrHandlerNotFound = errors.New("pool: durable handler not registered")
+	ErrHandlerName     = errors.New("pool: durable handler name too long")
+
+	ErrSupervisorSpec = errors.New("supervisor: spec without run func")
+
+	ErrNodeExists  = errors.New("graph: node with the same name exists")
+	ErrUnknownNode = errors.New("graph: unknown dependency")
+	ErrGraphCycle  = errors.New("graph: dependency cycle")
+	ErrNodeFailed  = errors.New("graph: node failed")
+
+	ErrBatchResults = errors.New("task: number of batch results mismatches arguments")
+
+	ErrWorkerInit          = errors.New("worker: worker initialization failed")
+	ErrInvalidCPU          = errors.New("worker: invalid cpu index")
+	ErrAffinityUnsupported = errors.New("worker: cpu affinity is unsupported on this platform")
 )
 
 // constraints for pool
@@ -19,9 +55,14 @@ const (
 	// worker will be set to idle after defaultWorkerIdleDuration.
 	defaultWorkerIdleDuration = defaultPurgeWorkersDuration / 2
 
-	// default pool capacity is defaultPoolCapacityFactor * NumCPU
+	// default pool capacity is defaultPoolCapacityFactor * NumCPU, or cpu
+	// quota of cgroup if limited.
 	defaultPoolCapacityFactor = 16
 
+	// default pool capacity is also bounded by cgroup memory limit, each
+	// worker is budgeted defaultWorkerMemoryBudget bytes.
+	defaultWorkerMemoryBudget = 1 << 20
+
 	// default task queue size, each worker hold 128 buffered tasks.
 	defaultTaskQueueSize = defaultPoolCapacityFactor * 128
 
@@ -31,4 +72,42 @@ const (
 	// pool auto expand its capacity when its len(tasksQueue) / cap(taskQueue) equals or
 	// greater than autoScaleFactor
 	autoScaleFactor = 0.75
+
+	// paused pool is checked for resuming every defaultPauseCheckInterval
+	// by background dispatchers.
+	defaultPauseCheckInterval = 10 * time.Millisecond
+
+	// circuit breaker keeps open for defaultBreakerCooldown before
+	// letting probe calls pass.
+	defaultBreakerCooldown = 5 * time.Second
+
+	// default max number of results hold by result cache.
+	defaultCacheSize = 1024
+
+	// default max number of task names broken down by Stats.Tasks.
+	defaultMaxTaskNames = 1024
+
+	// default number of finished tasks kept by task registry.
+	defaultTaskRetention = 1024
+
+	// tenants not configured are evicted after idle for
+	// defaultTenantIdleTimeout.
+	defaultTenantIdleTimeout = time.Minute
+
+	// default size of write-ahead log segment rolled over at.
+	defaultWALSegmentSize = 64 << 20
+
+	// default interval of flushing write-ahead log periodically.
+	defaultWALSyncInterval = time.Second
+
+	// default size of event buffer of supervised task.
+	defaultSupervisorEvents = 16
+
+	// default delay ahead of the first restart of supervised task, and
+	// the max one it doubles to.
+	defaultSupervisorBackoff    = 100 * time.Millisecond
+	defaultSupervisorMaxBackoff = 30 * time.Second
+
+	// default max interval of watchdog checking running tasks.
+	defaultWatchdogInterval = time.Second
 )
@@ -0,0 +1,280 @@
+package pond
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// NodeStatus is the execution status of a node of Graph.
+type NodeStatus int32
+
+const (
+	// NodePending wait for its dependencies.
+	NodePending NodeStatus = iota
+	// NodeRunning is submitted to pool.
+	NodeRunning
+	// NodeDone done without error.
+	NodeDone
+	// NodeFailed done with error.
+	NodeFailed
+	// NodeSkipped is not run because its dependencies failed, see
+	// SkipDependents.
+	NodeSkipped
+)
+
+func (s NodeStatus) String() string {
+	switch s {
+	case NodePending:
+		return "pending"
+	case NodeRunning:
+		return "running"
+	case NodeDone:
+		return "done"
+	case NodeFailed:
+		return "failed"
+	case NodeSkipped:
+		return "skipped"
+	}
+	return "unknown"
+}
+
+// FailurePolicy decide how a failed node affects its dependents.
+type FailurePolicy int
+
+const (
+	// SkipDependents skip all nodes depending on failed nodes directly
+	// or transitively.
+	SkipDependents FailurePolicy = iota
+	// ContinueOnError run dependents of failed nodes as well, they
+	// receive errors of failed dependencies.
+	ContinueOnError
+)
+
+// NodeResult is the outcome of a node.
+type NodeResult struct {
+	Status NodeStatus
+	Value  interface{}
+	Err    error
+}
+
+// NodeFunc is the task of a node, it receives results of dependencies by
+// their names.
+type NodeFunc func(deps map[string]NodeResult) (interface{}, error)
+
+type node struct {
+	name string
+	task NodeFunc
+	deps []string
+
+	result NodeResult
+	done   chan struct{}
+}
+
+// Graph is a set of tasks with dependencies, every node starts as soon as
+// its dependencies finished. Nodes can be added in any order, dependencies
+// are validated by Validate or Run. A Graph must not be run concurrently.
+type Graph struct {
+	policy FailurePolicy
+
+	mu    sync.Mutex
+	nodes map[string]*node
+	order []string
+}
+
+// NewGraph return an empty Graph handling failures by policy.
+func NewGraph(policy FailurePolicy) *Graph {
+	return &Graph{policy: policy, nodes: make(map[string]*node)}
+}
+
+// Add add a node of name running task after deps finished, ErrNodeExists
+// returned if name is taken.
+func (g *Graph) Add(name string, task NodeFunc, deps ...string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, ok := g.nodes[name]; ok {
+		return ErrNodeExists
+	}
+	g.nodes[name] = &node{name: name, task: task, deps: deps}
+	g.order = append(g.order, name)
+	return nil
+}
+
+// Validate check that all dependencies exist and there is no cycle.
+func (g *Graph) Validate() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.validate()
+}
+
+func (g *Graph) validate() error {
+	for _, name := range g.order {
+		for _, dep := range g.nodes[name].deps {
+			if _, ok := g.nodes[dep]; !ok {
+				return fmt.Errorf("%w: %s of %s", ErrUnknownNode, dep, name)
+			}
+		}
+	}
+
+	// depth first search, nodes on current path are visiting.
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	marks := make(map[string]int, len(g.nodes))
+	var path []string
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch marks[name] {
+		case visiting:
+			for i, n := range path {
+				if n == name {
+					return fmt.Errorf("%w: %s", ErrGraphCycle, strings.Join(append(path[i:], name), " -> "))
+				}
+			}
+		case visited:
+			return nil
+		}
+		marks[name] = visiting
+		path = append(path, name)
+		for _, dep := range g.nodes[name].deps {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		marks[name] = visited
+		return nil
+	}
+	for _, name := range g.order {
+		if err := visit(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run validate the graph and run its nodes on pool, it blocks until all
+// nodes finished and return their results by names. The error is of the
+// first failed node in order of adding, wrapped by ErrNodeFailed. Nodes
+// added during Run are not run until next Run. If pool is closed during
+// Run, nodes not done fail with ErrPoolClosed.
+func (g *Graph) Run(pool Pool) (map[string]NodeResult, error) {
+	g.mu.Lock()
+	if err := g.validate(); err != nil {
+		g.mu.Unlock()
+		return nil, err
+	}
+	// snapshot nodes so that Add during Run does not race with it.
+	nodes := make(map[string]*node, len(g.nodes))
+	order := append([]string(nil), g.order...)
+	for name, n := range g.nodes {
+		n.result, n.done = NodeResult{Status: NodePending}, make(chan struct{})
+		nodes[name] = n
+	}
+	g.mu.Unlock()
+
+	// nodes wait for dependencies outside pool, so that no worker is
+	// held by waiting.
+	for _, n := range nodes {
+		go g.run(pool, nodes, n)
+	}
+
+	results := make(map[string]NodeResult, len(nodes))
+	var firstErr error
+	for _, name := range order {
+		n := nodes[name]
+		<-n.done
+		res := g.resultOf(n)
+		results[name] = res
+		if res.Status == NodeFailed && firstErr == nil {
+			firstErr = fmt.Errorf("%w: %s: %v", ErrNodeFailed, name, res.Err)
+		}
+	}
+	return results, firstErr
+}
+
+// run wait for dependencies of n, then submit it to pool or skip it.
+func (g *Graph) run(pool Pool, nodes map[string]*node, n *node) {
+	defer close(n.done)
+
+	deps := make(map[string]NodeResult, len(n.deps))
+	skip := false
+	for _, dep := range n.deps {
+		d := nodes[dep]
+		<-d.done
+		res := g.resultOf(d)
+		deps[dep] = res
+		if res.Status != NodeDone && g.policy == SkipDependents {
+			skip = true
+		}
+	}
+	if skip {
+		g.setResult(n, NodeResult{Status: NodeSkipped})
+		return
+	}
+
+	g.setResult(n, NodeResult{Status: NodeRunning})
+	fut, err := pool.Submit(func() (interface{}, error) {
+		return n.task(deps)
+	})
+	var val interface{}
+	if err == nil {
+		val, err = fut.Value()
+	}
+	if err != nil {
+		g.setResult(n, NodeResult{Status: NodeFailed, Err: err})
+		return
+	}
+	g.setResult(n, NodeResult{Status: NodeDone, Value: val})
+}
+
+func (g *Graph) resultOf(n *node) NodeResult {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return n.result
+}
+
+func (g *Graph) setResult(n *node, res NodeResult) {
+	g.mu.Lock()
+	n.result = res
+	g.mu.Unlock()
+}
+
+// DOT export graph in Graphviz DOT format, nodes are labeled and colored
+// by their status of the latest run.
+func (g *Graph) DOT() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var b strings.Builder
+	b.WriteString("digraph {\n")
+	for _, name := range g.order {
+		status := g.nodes[name].result.Status
+		// label is quoted like IDs, so that names with quotes or
+		// backslashes stay valid.
+		fmt.Fprintf(&b, "\t%q [label=%q color=%s];\n", name, name+"\n"+status.String(), dotColor(status))
+	}
+	for _, name := range g.order {
+		for _, dep := range g.nodes[name].deps {
+			fmt.Fprintf(&b, "\t%q -> %q;\n", dep, name)
+		}
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func dotColor(status NodeStatus) string {
+	switch status {
+	case NodeRunning:
+		return "blue"
+	case NodeDone:
+		return "green"
+	case NodeFailed:
+		return "red"
+	case NodeSkipped:
+		return "gray"
+	}
+	return "black"
+}
@@ -0,0 +1,155 @@
+package pond
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func constNode(val interface{}) NodeFunc {
+	return func(map[string]NodeResult) (interface{}, error) {
+		return val, nil
+	}
+}
+
+func TestGraphRun(t *testing.T) {
+	fmt.Println(t.Name())
+	pool := NewPool(4)
+	defer pool.Close()
+
+	g := NewGraph(SkipDependents)
+	// nodes can be added ahead of dependencies.
+	_ = g.Add("sum", func(deps map[string]NodeResult) (interface{}, error) {
+		return deps["a"].Value.(int) + deps["b"].Value.(int), nil
+	}, "a", "b")
+	_ = g.Add("a", constNode(1))
+	_ = g.Add("b", func(deps map[string]NodeResult) (interface{}, error) {
+		return deps["a"].Value.(int) + 1, nil
+	}, "a")
+	if err := g.Add("a", constNode(1)); err != ErrNodeExists {
+		t.Error("name of node should not be taken again")
+	}
+
+	results, err := g.Run(pool)
+	if err != nil {
+		t.Error("graph should be run:", err)
+	}
+	if res := results["sum"]; res.Status != NodeDone || res.Value != 3 {
+		t.Errorf("node should receive results of dependencies, got %+v", res)
+	}
+
+	dot := g.DOT()
+	for _, line := range []string{`"a" -> "b";`, `"b" -> "sum";`, `"sum" [label="sum\ndone" color=green];`} {
+		if !strings.Contains(dot, line) {
+			t.Errorf("DOT should contain %s, got:\n%s", line, dot)
+		}
+	}
+
+	g = NewGraph(SkipDependents)
+	_ = g.Add(`say "hi"\`, constNode(1))
+	if dot := g.DOT(); !strings.Contains(dot, `"say \"hi\"\\" [label="say \"hi\"\\\npending" color=`) {
+		t.Errorf("quotes and backslashes of names should be escaped, got:\n%s", dot)
+	}
+}
+
+func TestGraphFailurePolicy(t *testing.T) {
+	fmt.Println(t.Name())
+	pool := NewPool(4)
+	defer pool.Close()
+	errBad := errors.New("bad")
+
+	build := func(policy FailurePolicy) *Graph {
+		g := NewGraph(policy)
+		_ = g.Add("a", func(map[string]NodeResult) (interface{}, error) { return nil, errBad })
+		_ = g.Add("b", func(deps map[string]NodeResult) (interface{}, error) {
+			return deps["a"].Err, nil
+		}, "a")
+		_ = g.Add("c", constNode(3), "b")
+		_ = g.Add("d", constNode(4))
+		return g
+	}
+
+	results, err := build(SkipDependents).Run(pool)
+	if !errors.Is(err, ErrNodeFailed) || !strings.Contains(err.Error(), "a: bad") {
+		t.Errorf("failure of a should be returned, got %v", err)
+	}
+	if results["b"].Status != NodeSkipped || results["c"].Status != NodeSkipped || results["d"].Status != NodeDone {
+		t.Errorf("dependents of failed node should be skipped, got %+v", results)
+	}
+
+	results, _ = build(ContinueOnError).Run(pool)
+	if res := results["b"]; res.Status != NodeDone || res.Value != errBad {
+		t.Errorf("b should receive error of a, got %+v", res)
+	}
+	if results["c"].Status != NodeDone {
+		t.Errorf("dependents of failed node should be run, got %+v", results)
+	}
+}
+
+func TestGraphPoolClosed(t *testing.T) {
+	fmt.Println(t.Name())
+	pool := NewPool(1)
+	release, started := make(chan struct{}), make(chan struct{})
+
+	g := NewGraph(SkipDependents)
+	_ = g.Add("a", func(map[string]NodeResult) (interface{}, error) {
+		close(started)
+		<-release
+		return nil, nil
+	})
+	_ = g.Add("b", constNode(2), "a")
+	_ = g.Add("c", constNode(3))
+	_ = g.Add("d", constNode(4), "c")
+
+	done := make(chan map[string]NodeResult)
+	go func() {
+		results, _ := g.Run(pool)
+		done <- results
+	}()
+	<-started
+	// c and d are held behind a.
+	time.Sleep(10 * time.Millisecond)
+	go pool.Close()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+
+	select {
+	case results := <-done:
+		if results["a"].Status != NodeDone {
+			t.Errorf("running node should be done, got %+v", results["a"])
+		}
+		if results["b"].Err != ErrPoolClosed {
+			t.Errorf("nodes submitted after pool closed should fail with ErrPoolClosed, got %+v", results["b"])
+		}
+		// c may be taken by the worker ahead of closing.
+		for _, name := range []string{"c", "d"} {
+			if res := results[name]; res.Status != NodeDone && res.Status != NodeSkipped && res.Err != ErrPoolClosed {
+				t.Errorf("nodes not done should fail with ErrPoolClosed, got %+v", res)
+			}
+		}
+	case <-time.After(time.Second):
+		t.Error("run should not block after pool closed")
+	}
+}
+
+func TestGraphValidate(t *testing.T) {
+	fmt.Println(t.Name())
+	g := NewGraph(SkipDependents)
+	_ = g.Add("a", constNode(1), "c")
+	_ = g.Add("b", constNode(2), "a")
+	_ = g.Add("c", constNode(3), "b")
+	err := g.Validate()
+	if !errors.Is(err, ErrGraphCycle) || !strings.Contains(err.Error(), "a -> c -> b -> a") {
+		t.Errorf("cycle should be reported with its path, got %v", err)
+	}
+
+	g = NewGraph(SkipDependents)
+	_ = g.Add("a", constNode(1), "x")
+	pool := NewPool(1)
+	defer pool.Close()
+	if _, err := g.Run(pool); !errors.Is(err, ErrUnknownNode) {
+		t.Errorf("unknown dependency should be reported, got %v", err)
+	}
+}
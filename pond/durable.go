@@ -0,0 +1,198 @@
+package pond
+
+import (
+	"fmt"
+	"math"
+	"sync"
+)
+
+// DurableSubmitter is implemented by pools accepting durable tasks, see
+// WithDurableQueue. Durable tasks are delivered at least once: a task is
+// acknowledged after its handler returned, so that a task interrupted by
+// crash, or acknowledged by a failed write, is run again by Replay after
+// restart. Handlers should be idempotent.
+type DurableSubmitter interface {
+	// RegisterHandler register handler of durable tasks by name.
+	RegisterHandler(name string, handler DurableHandler) error
+
+	// SubmitDurable submit a durable task running handler of name with
+	// payload, it survives crash.
+	SubmitDurable(name string, payload []byte) (Future, error)
+
+	// Replay push durable tasks not done before restart into task queue.
+	Replay() (int, error)
+}
+
+// DurableHandler handle payload of task submitted by SubmitDurable.
+type DurableHandler func(payload []byte) (interface{}, error)
+
+// durableQueue persist tasks submitted by SubmitDurable in write-ahead
+// log, the log is opened on first use.
+type durableQueue struct {
+	cfg DurableConfig
+
+	once sync.Once
+	wal  *wal
+	err  error
+
+	// recovered hold tasks not done before restart and not replayed.
+	replayMu  sync.Mutex
+	recovered []walEntry
+
+	mu       sync.RWMutex
+	handlers map[string]DurableHandler
+
+	// running count durable tasks under execution, the log is closed
+	// after all of them acknowledged. Tasks starting after closed are
+	// left for Replay.
+	runMu   sync.Mutex
+	closed  bool
+	running sync.WaitGroup
+}
+
+func newDurableQueue(cfg DurableConfig) *durableQueue {
+	return &durableQueue{cfg: cfg, handlers: make(map[string]DurableHandler)}
+}
+
+func (d *durableQueue) open() error {
+	d.once.Do(func() {
+		d.wal, d.recovered, d.err = openWAL(d.cfg)
+	})
+	return d.err
+}
+
+func (d *durableQueue) handler(name string) (DurableHandler, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	h, ok := d.handlers[name]
+	return h, ok
+}
+
+// task run handler with payload and acknowledge it after done, even if
+// handler panicked, task interrupted by crash is replayed. Failure of
+// acknowledging is passed to report.
+func (d *durableQueue) task(seq uint64, h DurableHandler, payload []byte, report func(error)) Task {
+	return func() (interface{}, error) {
+		d.runMu.Lock()
+		if d.closed {
+			d.runMu.Unlock()
+			return nil, ErrPoolClosed
+		}
+		d.running.Add(1)
+		d.runMu.Unlock()
+		defer d.running.Done()
+
+		defer func() {
+			if err := d.wal.ack(seq); err != nil {
+				report(fmt.Errorf("durable: ack task %d: %w", seq, err))
+			}
+		}()
+		return h(payload)
+	}
+}
+
+// close wait for durable tasks running and close the log.
+func (d *durableQueue) close() {
+	d.once.Do(func() {
+		d.err = ErrPoolClosed
+	})
+	d.runMu.Lock()
+	d.closed = true
+	d.runMu.Unlock()
+	d.running.Wait()
+	if d.wal != nil {
+		d.wal.close()
+	}
+}
+
+// RegisterHandler register handler of durable tasks by name, it should be
+// invoked ahead of Replay and SubmitDurable.
+func (bp *basicPool) RegisterHandler(name string, handler DurableHandler) error {
+	if bp.durable == nil {
+		return ErrDurableDisabled
+	}
+	if len(name) > math.MaxUint16 {
+		return ErrHandlerName
+	}
+	bp.durable.mu.Lock()
+	defer bp.durable.mu.Unlock()
+	bp.durable.handlers[name] = handler
+	return nil
+}
+
+// SubmitDurable log payload in write-ahead log and submit a task running
+// handler of name with it. The task is replayed by Replay after restart
+// unless it was done, see DurableSubmitter.
+func (bp *basicPool) SubmitDurable(name string, payload []byte) (Future, error) {
+	if bp.durable == nil {
+		return nil, ErrDurableDisabled
+	}
+	h, ok := bp.durable.handler(name)
+	if !ok {
+		return nil, ErrHandlerNotFound
+	}
+	if err := bp.durable.open(); err != nil {
+		return nil, err
+	}
+	// check ahead of logging, so that rejected tasks are rarely logged.
+	select {
+	case <-bp.close:
+		return nil, ErrPoolClosed
+	default:
+	}
+	if len(bp.pause) > 0 {
+		return nil, ErrPoolPaused
+	}
+
+	payload = append([]byte(nil), payload...)
+	seq, err := bp.durable.wal.submit(name, payload)
+	if err != nil {
+		return nil, err
+	}
+	fut, err := bp.submit(rscPool.GetTask(statelessTask(bp.durable.task(seq, h, payload, bp.reportError)), nil), -1)
+	if err != nil {
+		// caller knows it is rejected, never replay it.
+		if ackErr := bp.durable.wal.ack(seq); ackErr != nil {
+			bp.reportError(fmt.Errorf("durable: ack task %d: %w", seq, ackErr))
+		}
+		return nil, err
+	}
+	return fut, nil
+}
+
+// Replay push tasks not done before restart into task queue, and return
+// the number of them. Tasks whose handlers not registered are kept for
+// next Replay, ErrHandlerNotFound returned for them.
+func (bp *basicPool) Replay() (int, error) {
+	if bp.durable == nil {
+		return 0, ErrDurableDisabled
+	}
+	d := bp.durable
+	if err := d.open(); err != nil {
+		return 0, err
+	}
+	d.replayMu.Lock()
+	defer d.replayMu.Unlock()
+
+	var (
+		remaining []walEntry
+		replayed  int
+		firstErr  error
+	)
+	for i, e := range d.recovered {
+		h, ok := d.handler(e.name)
+		if !ok {
+			remaining = append(remaining, e)
+			firstErr = ErrHandlerNotFound
+			continue
+		}
+		if !bp.dispatch(rscPool.GetTask(statelessTask(d.task(e.seq, h, e.payload, bp.reportError)), nil)) {
+			remaining = append(remaining, d.recovered[i:]...)
+			firstErr = ErrPoolClosed
+			break
+		}
+		replayed++
+	}
+	d.recovered = remaining
+	return replayed, firstErr
+}
@@ -0,0 +1,267 @@
+package pond
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDurableQueue(t *testing.T) {
+	fmt.Println(t.Name())
+	dir, err := ioutil.TempDir("", "pond-wal")
+	if err != nil {
+		t.Error("temp dir should be created:", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	cfg := DurableConfig{Dir: dir}
+
+	pool := NewPoolWithOptions(WithCapacity(1), WithDurableQueue(cfg))
+	durable := pool.(DurableSubmitter)
+	if _, err := durable.SubmitDurable("echo", []byte("x")); err != ErrHandlerNotFound {
+		t.Error("task of unregistered handler should not be submitted")
+	}
+	release, started := make(chan struct{}), make(chan struct{})
+	_ = durable.RegisterHandler("echo", func(payload []byte) (interface{}, error) {
+		if string(payload) == "block" {
+			close(started)
+			<-release
+		}
+		return string(payload), nil
+	})
+
+	future, err := durable.SubmitDurable("echo", []byte("done"))
+	if err != nil {
+		t.Error("durable task should be submitted:", err)
+		return
+	}
+	if val, _ := future.Value(); val != "done" {
+		t.Errorf("durable task should run its handler, got %v", val)
+	}
+	// the blocked task holds the only worker, so the rest stay queued
+	// when pool closed.
+	for _, payload := range []string{"block", "a", "b"} {
+		if _, err := durable.SubmitDurable("echo", []byte(payload)); err != nil {
+			t.Error("durable task should be submitted:", err)
+		}
+	}
+	<-started
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		close(release)
+	}()
+	beg := time.Now()
+	pool.Close()
+	if time.Since(beg) < 20*time.Millisecond {
+		t.Error("closing pool should wait for running durable task")
+	}
+
+	// restart with the same log.
+	pool = NewPoolWithOptions(WithCapacity(2), WithDurableQueue(cfg))
+	defer pool.Close()
+	durable = pool.(DurableSubmitter)
+	if n, err := durable.Replay(); n != 0 || err != ErrHandlerNotFound {
+		t.Errorf("tasks of unregistered handler should be kept, got %d %v", n, err)
+	}
+
+	var (
+		mu       sync.Mutex
+		replayed []string
+		wg       sync.WaitGroup
+	)
+	wg.Add(2)
+	_ = durable.RegisterHandler("echo", func(payload []byte) (interface{}, error) {
+		mu.Lock()
+		replayed = append(replayed, string(payload))
+		mu.Unlock()
+		wg.Done()
+		return nil, nil
+	})
+	if n, err := durable.Replay(); n != 2 || err != nil {
+		t.Errorf("queued tasks should be replayed, got %d %v", n, err)
+	}
+	wg.Wait()
+	sort.Strings(replayed)
+	if len(replayed) != 2 || replayed[0] != "a" || replayed[1] != "b" {
+		t.Errorf("only tasks not done should be replayed, got %v", replayed)
+	}
+	if n, _ := durable.Replay(); n != 0 {
+		t.Errorf("replayed tasks should not be replayed again, got %d", n)
+	}
+}
+
+func TestDurableQueueAckPanic(t *testing.T) {
+	fmt.Println(t.Name())
+	dir, err := ioutil.TempDir("", "pond-wal")
+	if err != nil {
+		t.Error("temp dir should be created:", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	cfg := DurableConfig{Dir: dir}
+
+	pool := NewPoolWithOptions(WithCapacity(1), WithDurableQueue(cfg), WithMiddleware(RecoveryMiddleware()))
+	durable := pool.(DurableSubmitter)
+	_ = durable.RegisterHandler("panic", func([]byte) (interface{}, error) {
+		panic("boom")
+	})
+	future, _ := durable.SubmitDurable("panic", nil)
+	if _, err := future.Value(); !errors.Is(err, ErrTaskPanicked) {
+		t.Errorf("panic of handler should be recovered, got %v", err)
+	}
+	pool.Close()
+
+	pool = NewPoolWithOptions(WithCapacity(1), WithDurableQueue(cfg))
+	defer pool.Close()
+	_ = pool.(DurableSubmitter).RegisterHandler("panic", func([]byte) (interface{}, error) {
+		return nil, nil
+	})
+	if n, _ := pool.(DurableSubmitter).Replay(); n != 0 {
+		t.Errorf("panicked task should be acknowledged, got %d replayed", n)
+	}
+}
+
+func TestDurableQueueDisabled(t *testing.T) {
+	fmt.Println(t.Name())
+	pool := NewPool(1)
+	defer pool.Close()
+	durable := pool.(DurableSubmitter)
+	if err := durable.RegisterHandler("echo", nil); err != ErrDurableDisabled {
+		t.Error("handler should not be registered unless enabled")
+	}
+	if _, err := durable.SubmitDurable("echo", nil); err != ErrDurableDisabled {
+		t.Error("durable task should not be submitted unless enabled")
+	}
+	if _, err := durable.Replay(); err != ErrDurableDisabled {
+		t.Error("durable tasks should not be replayed unless enabled")
+	}
+}
+
+func TestWALCompaction(t *testing.T) {
+	fmt.Println(t.Name())
+	dir, err := ioutil.TempDir("", "pond-wal")
+	if err != nil {
+		t.Error("temp dir should be created:", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	cfg := DurableConfig{Dir: dir, Sync: SyncNever, SegmentSize: 64}
+
+	w, recovered, err := openWAL(cfg)
+	if err != nil || len(recovered) != 0 {
+		t.Errorf("empty log should be opened, got %v %v", recovered, err)
+		return
+	}
+	var seqs []uint64
+	for i := 0; i < 10; i++ {
+		seq, err := w.submit("task", []byte("0123456789"))
+		if err != nil {
+			t.Error("task should be logged:", err)
+			return
+		}
+		seqs = append(seqs, seq)
+	}
+	// keep the first task pending, it pins all segments.
+	for _, seq := range seqs[1:] {
+		_ = w.ack(seq)
+	}
+	if segments, _ := listSegments(dir); len(segments) < 3 {
+		t.Errorf("segments should be rolled over, got %d", len(segments))
+	}
+	_ = w.ack(seqs[0])
+	if segments, _ := listSegments(dir); len(segments) != 1 {
+		t.Errorf("acknowledged segments should be removed, got %d", len(segments))
+	}
+	_ = w.close()
+
+	// torn tail left by crash is ignored.
+	w, _, _ = openWAL(cfg)
+	seq, _ := w.submit("task", []byte("kept"))
+	_ = w.close()
+	segments, _ := listSegments(dir)
+	f, _ := os.OpenFile(segmentPath(dir, segments[len(segments)-1]), os.O_WRONLY|os.O_APPEND, 0644)
+	_, _ = f.Write([]byte{0, 0, 0, 9, 1, 2})
+	f.Close()
+
+	w, recovered, err = openWAL(cfg)
+	if err != nil {
+		t.Error("log should be opened:", err)
+		return
+	}
+	defer w.close()
+	if len(recovered) != 1 || recovered[0].seq != seq || string(recovered[0].payload) != "kept" {
+		t.Errorf("tasks before torn tail should be recovered, got %+v", recovered)
+	}
+	if next, _ := w.submit("task", nil); next != seq+1 {
+		t.Errorf("sequence should continue from %d, got %d", seq, next)
+	}
+}
+
+func TestWALAppendFailure(t *testing.T) {
+	fmt.Println(t.Name())
+	dir, err := ioutil.TempDir("", "pond-wal")
+	if err != nil {
+		t.Error("temp dir should be created:", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	cfg := DurableConfig{Dir: dir, Sync: SyncNever}
+
+	w, _, _ := openWAL(cfg)
+	kept, _ := w.submit("task", []byte("kept"))
+	// writing to closed file fails, and so does truncating it.
+	w.file.Close()
+	if _, err := w.submit("task", []byte("lost")); err == nil {
+		t.Error("failed write should be returned")
+	}
+	next, err := w.submit("task", []byte("next"))
+	if err != nil {
+		t.Error("log should recover from failed write:", err)
+	}
+	_ = w.close()
+
+	w, recovered, err := openWAL(cfg)
+	if err != nil {
+		t.Error("log should be opened:", err)
+		return
+	}
+	defer w.close()
+	if len(recovered) != 2 || recovered[0].seq != kept || recovered[1].seq != next || string(recovered[1].payload) != "next" {
+		t.Errorf("failed record should not be recovered, got %+v", recovered)
+	}
+}
+
+func TestWALGarbageLength(t *testing.T) {
+	fmt.Println(t.Name())
+	dir, err := ioutil.TempDir("", "pond-wal")
+	if err != nil {
+		t.Error("temp dir should be created:", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	cfg := DurableConfig{Dir: dir, Sync: SyncNever}
+
+	w, _, _ := openWAL(cfg)
+	seq, _ := w.submit("task", []byte("kept"))
+	_ = w.close()
+	segments, _ := listSegments(dir)
+	f, _ := os.OpenFile(segmentPath(dir, segments[len(segments)-1]), os.O_WRONLY|os.O_APPEND, 0644)
+	// length of record claims almost 4 GiB.
+	_, _ = f.Write([]byte{0xff, 0xff, 0xff, 0xf0, 0, 0, 0, 0, 1})
+	f.Close()
+
+	w, recovered, err := openWAL(cfg)
+	if err != nil {
+		t.Error("log should be opened:", err)
+		return
+	}
+	defer w.close()
+	if len(recovered) != 1 || recovered[0].seq != seq {
+		t.Errorf("record of garbage length should be taken as torn tail, got %+v", recovered)
+	}
+}
@@ -9,14 +9,118 @@ import (
 // get return value.
 type Task func() (interface{}, error)
 
+// StatefulTask is a task which receive the state owned by the worker
+// executing it, see WithWorkerState.
+type StatefulTask func(state interface{}) (interface{}, error)
+
+func statelessTask(task Task) StatefulTask {
+	return func(interface{}) (interface{}, error) {
+		return task()
+	}
+}
+
 type taskResult struct {
 	val interface{}
 	err error
 }
 
-type taskWrapper struct {
+// TaskEnvelope carries a submitted Task from pool to workers, workers
+// receive envelopes from task queue, execute the task and report the
+// result back through it.
+type TaskEnvelope struct {
 	t       Task
+	st      StatefulTask
+	state   interface{}
+	cost    int
+	meta    *TaskOptions
 	resChan chan *taskResult
+
+	// dropped is invoked if envelope is dropped without execution, such
+	// as left in queues after pool closed.
+	dropped func()
+
+	// worker is the default worker executing the task, it is nil for
+	// customized workers.
+	worker *pondWorker
+
+	// reported is set once result delivered to Future, tasks cancelled by
+	// task registry are reported ahead of execution.
+	reported int32
+}
+
+// Task return the task carried by envelope.
+func (te *TaskEnvelope) Task() Task {
+	return te.t
+}
+
+// Metadata return the metadata of task, ok is false if task submitted
+// without TaskOptions.
+func (te *TaskEnvelope) Metadata() (meta TaskOptions, ok bool) {
+	if te.meta == nil {
+		return TaskOptions{}, false
+	}
+	return *te.meta, true
+}
+
+// Report deliver the return values of task to the associated Future,
+// it must be invoked exactly once for every envelope. Envelope is not
+// recycled after reported, the carried task may be still referenced by
+// middlewares, e.g. DeadlineMiddleware, so that workers can keep using
+// it afterwards. It is a no-op if task has been cancelled, see
+// TaskTracker.
+func (te *TaskEnvelope) Report(val interface{}, err error) {
+	if atomic.CompareAndSwapInt32(&te.reported, 0, 1) {
+		te.resChan <- rscPool.GetTaskResult(val, err)
+	}
+}
+
+// cancel resolve the associated Future with ErrTaskCancelled, the task is
+// still received by workers and reports nothing then. It returns false if
+// task has been reported.
+func (te *TaskEnvelope) cancel() bool {
+	if !atomic.CompareAndSwapInt32(&te.reported, 0, 1) {
+		return false
+	}
+	te.resChan <- rscPool.GetTaskResult(nil, ErrTaskCancelled)
+	return true
+}
+
+// onDrop register f to be invoked if envelope is dropped without
+// execution, so that resources acquired for the task are released.
+func (te *TaskEnvelope) onDrop(f func()) {
+	if prev := te.dropped; prev != nil {
+		te.dropped = func() {
+			prev()
+			f()
+		}
+		return
+	}
+	te.dropped = f
+}
+
+// drop report err to the associated Future of envelope not executed.
+func (te *TaskEnvelope) drop(err error) {
+	if te.dropped != nil {
+		te.dropped()
+	}
+	te.Report(nil, err)
+}
+
+// Execute run the carried task and report its return values.
+func (te *TaskEnvelope) Execute() {
+	te.Report(te.t())
+}
+
+// ExecuteWithState run the carried task with state owned by worker and
+// report its return values, the state is visible to StatefulTask only.
+func (te *TaskEnvelope) ExecuteWithState(state interface{}) {
+	te.state = state
+	te.Report(te.t())
+}
+
+// call invoke the stateful task with state bound by worker.
+func (te *TaskEnvelope) call() (interface{}, error) {
+	return te.st(te.state)
 }
 
 // Future associate with a Task instance and can be used to capture
@@ -45,12 +149,20 @@ type pondFuture struct {
 	err   error
 	done  chan *taskResult
 	ready int32
+
+	version uint64
+	id      string
 }
 
 func newPondFuture(doneC chan *taskResult) *pondFuture {
 	return &pondFuture{done: doneC}
 }
 
+// newCompletedFuture return a Future already done with val and err.
+func newCompletedFuture(val interface{}, err error) *pondFuture {
+	return &pondFuture{value: val, err: err, ready: 1}
+}
+
 func (pf *pondFuture) Value() (interface{}, error) {
 	if atomic.LoadInt32(&pf.ready) != 0 {
 		return pf.value, pf.err
@@ -77,6 +189,7 @@ func (pf *pondFuture) Value() (interface{}, error) {
 func (pf *pondFuture) Then(next func(interface{}) (interface{}, error)) Future {
 	doneC := make(chan *taskResult)
 	f := newPondFuture(doneC)
+	f.version, f.id = pf.version, pf.id
 	go func() {
 		val, err := pf.Value()
 		if err != nil {
@@ -106,3 +219,14 @@ func (pf *pondFuture) OnFailure(f func(err error)) {
 		}
 	}()
 }
+
+// Version return the version of fixed function which served the task, it
+// is 0 for tasks not submitted to FixedFuncPool, see VersionedFuture.
+func (pf *pondFuture) Version() uint64 {
+	return pf.version
+}
+
+// ID return the ID of task, see IdentifiedFuture.
+func (pf *pondFuture) ID() string {
+	return pf.id
+}
@@ -0,0 +1,247 @@
+package pond
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// LimitAlgorithm decide the allowed concurrency of pool by observed task
+// latency, it must be safe for concurrent use.
+type LimitAlgorithm interface {
+	// Limit return current concurrency limit.
+	Limit() int
+
+	// Update feed a latency sample of task, inflight is the number of
+	// running tasks when it started, and dropped reports whether task
+	// is timeout, return the new concurrency limit.
+	Update(rtt time.Duration, inflight int, dropped bool) int
+}
+
+// AIMDLimit increase the limit by one when tasks done in time, and
+// multiply it by BackoffRatio when task dropped or its latency exceeds
+// Timeout, like TCP congestion control.
+type AIMDLimit struct {
+	// BackoffRatio is in (0, 1), default is 0.9.
+	BackoffRatio float64
+	// Timeout is the latency treated as dropped, 0 means no timeout.
+	Timeout time.Duration
+
+	mu       sync.Mutex
+	limit    int
+	minLimit int
+	maxLimit int
+}
+
+// NewAIMDLimit return an AIMDLimit with initial limit and its bounds.
+func NewAIMDLimit(initial, min, max int) *AIMDLimit {
+	return &AIMDLimit{
+		BackoffRatio: 0.9,
+		limit:        initial,
+		minLimit:     min,
+		maxLimit:     max,
+	}
+}
+
+func (l *AIMDLimit) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+func (l *AIMDLimit) Update(rtt time.Duration, inflight int, dropped bool) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if dropped || (l.Timeout > 0 && rtt > l.Timeout) {
+		l.limit = int(float64(l.limit) * l.BackoffRatio)
+	} else if inflight*2 >= l.limit {
+		// only grow when limit is really used, otherwise an idle pool
+		// inflates its limit without any evidence.
+		l.limit++
+	}
+	l.limit = clampLimit(l.limit, l.minLimit, l.maxLimit)
+	return l.limit
+}
+
+// VegasLimit estimate the queueing of downstream by comparing latency
+// with the minimum one observed, which is treated as no-load latency,
+// like TCP Vegas. Limit grows fast when no queueing, and shrinks when
+// queue is longer than expected.
+type VegasLimit struct {
+	mu       sync.Mutex
+	limit    int
+	minLimit int
+	maxLimit int
+	minRTT   time.Duration
+}
+
+// NewVegasLimit return a VegasLimit with initial limit and its bounds.
+func NewVegasLimit(initial, min, max int) *VegasLimit {
+	return &VegasLimit{
+		limit:    initial,
+		minLimit: min,
+		maxLimit: max,
+	}
+}
+
+func (l *VegasLimit) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+func (l *VegasLimit) Update(rtt time.Duration, inflight int, dropped bool) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if rtt <= 0 {
+		return l.limit
+	}
+	if l.minRTT == 0 || rtt < l.minRTT {
+		l.minRTT = rtt
+	}
+
+	// thresholds scale with log10 of limit, so that large limits are
+	// adjusted in bigger steps.
+	step := int(math.Log10(float64(l.limit)))
+	if step < 1 {
+		step = 1
+	}
+	alpha, beta := 3*step, 6*step
+
+	if dropped {
+		l.limit -= step
+	} else if inflight*2 >= l.limit {
+		queue := int(math.Ceil(float64(l.limit) * (1 - float64(l.minRTT)/float64(rtt))))
+		switch {
+		case queue <= step:
+			l.limit += beta
+		case queue < alpha:
+			l.limit += step
+		case queue > beta:
+			l.limit -= step
+		}
+	}
+	l.limit = clampLimit(l.limit, l.minLimit, l.maxLimit)
+	return l.limit
+}
+
+func clampLimit(limit, min, max int) int {
+	if limit < min {
+		limit = min
+	}
+	if limit > max {
+		limit = max
+	}
+	if limit < 1 {
+		limit = 1
+	}
+	return limit
+}
+
+// adaptiveLimiter hold permits of running tasks, the number of permits
+// is adjusted by algorithm after every task done. Effective concurrency
+// of pool is the smaller one of limit and number of workers.
+type adaptiveLimiter struct {
+	algo  LimitAlgorithm
+	clock Clock
+	close <-chan struct{}
+
+	mu       sync.Mutex
+	inflight int
+	// changed is closed and replaced when a permit released.
+	changed chan struct{}
+}
+
+func newAdaptiveLimiter(algo LimitAlgorithm, clock Clock, close <-chan struct{}) *adaptiveLimiter {
+	return &adaptiveLimiter{
+		algo:    algo,
+		clock:   clock,
+		close:   close,
+		changed: make(chan struct{}),
+	}
+}
+
+// acquire block until a permit available, return number of running
+// tasks including this one, or false if pool closed.
+func (l *adaptiveLimiter) acquire() (int, bool) {
+	for {
+		l.mu.Lock()
+		if l.inflight < l.algo.Limit() {
+			l.inflight++
+			inflight := l.inflight
+			l.mu.Unlock()
+			return inflight, true
+		}
+		changed := l.changed
+		l.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-l.close:
+			return 0, false
+		}
+	}
+}
+
+func (l *adaptiveLimiter) release(rtt time.Duration, inflight int, dropped bool) {
+	l.mu.Lock()
+	l.inflight--
+	l.algo.Update(rtt, inflight, dropped)
+	l.mu.Unlock()
+	l.notify()
+}
+
+// notify wake up goroutines waiting for permits to check limit again.
+func (l *adaptiveLimiter) notify() {
+	l.mu.Lock()
+	close(l.changed)
+	l.changed = make(chan struct{})
+	l.mu.Unlock()
+}
+
+// track make task feed its latency to algorithm and release its permit
+// after done. Timeout errors are treated as dropped.
+func (l *adaptiveLimiter) track(te *TaskEnvelope, inflight int) {
+	inner := te.t
+	te.t = func() (val interface{}, err error) {
+		beg := l.clock.Now()
+		defer func() {
+			dropped := errors.Is(err, ErrTaskDeadline) || errors.Is(err, ErrTaskTimeout)
+			l.release(l.clock.Now().Sub(beg), inflight, dropped)
+		}()
+		return inner()
+	}
+	te.onDrop(func() {
+		l.release(0, inflight, false)
+	})
+}
+
+// dispatchLimited forward tasks from limitQ to taskQ once a permit of
+// adaptive limit acquired, tasks wait here instead of holding workers.
+// It stops forwarding while pool paused.
+func (bp *basicPool) dispatchLimited() {
+	for {
+		select {
+		case <-bp.close:
+			return
+		case te := <-bp.limitQ:
+			if !bp.waitResumed() {
+				te.drop(ErrPoolClosed)
+				return
+			}
+			inflight, ok := bp.limiter.acquire()
+			if !ok {
+				te.drop(ErrPoolClosed)
+				return
+			}
+			bp.limiter.track(te, inflight)
+			if !bp.forward(te, bp.taskQ) {
+				te.drop(ErrPoolClosed)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package pond
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeClock advance step every time Now is invoked.
+type fakeClock struct {
+	mu   sync.Mutex
+	now  time.Time
+	step time.Duration
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(c.step)
+	return c.now
+}
+
+func TestAIMDLimit(t *testing.T) {
+	fmt.Println(t.Name())
+	l := NewAIMDLimit(10, 2, 12)
+	l.Timeout = 100 * time.Millisecond
+	if l.Update(time.Millisecond, 10, false) != 11 {
+		t.Error("limit should increase by one when task done in time")
+	}
+	if l.Update(time.Millisecond, 1, false) != 11 {
+		t.Error("limit should not increase when it is not used")
+	}
+	l.Update(time.Millisecond, 11, false)
+	if l.Update(time.Millisecond, 12, false) != 12 {
+		t.Error("limit should not exceed max")
+	}
+	if l.Update(time.Second, 12, false) != 10 {
+		t.Error("limit should back off when latency exceeds timeout")
+	}
+	for i := 0; i < 10; i++ {
+		l.Update(time.Millisecond, 10, true)
+	}
+	if l.Limit() != 2 {
+		t.Error("limit should not be lower than min")
+	}
+}
+
+func TestVegasLimit(t *testing.T) {
+	fmt.Println(t.Name())
+	l := NewVegasLimit(10, 1, 100)
+	l.Update(10*time.Millisecond, 10, false)
+	if l.Limit() != 16 {
+		t.Errorf("limit should grow fast without queueing, got %d", l.Limit())
+	}
+	l.Update(100*time.Millisecond, 16, false)
+	if l.Limit() != 15 {
+		t.Errorf("limit should shrink when latency rises, got %d", l.Limit())
+	}
+	l.Update(10*time.Millisecond, 15, true)
+	if l.Limit() != 14 {
+		t.Errorf("limit should shrink when task dropped, got %d", l.Limit())
+	}
+}
+
+func TestAdaptiveLimiter(t *testing.T) {
+	fmt.Println(t.Name())
+	algo := NewAIMDLimit(1, 1, 1)
+	algo.Timeout = time.Second
+	clock := &fakeClock{step: 2 * time.Second}
+	pool := NewPoolWithOptions(WithCapacity(4), WithClock(clock), WithAdaptiveLimit(algo))
+
+	var running, peak int32
+	var futures []Future
+	for i := 0; i < 8; i++ {
+		future, _ := pool.Submit(func() (interface{}, error) {
+			n := atomic.AddInt32(&running, 1)
+			if n > atomic.LoadInt32(&peak) {
+				atomic.StoreInt32(&peak, n)
+			}
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			return nil, nil
+		})
+		futures = append(futures, future)
+	}
+	for _, future := range futures {
+		_, _ = future.Value()
+	}
+	if atomic.LoadInt32(&peak) != 1 {
+		t.Errorf("running tasks should not exceed limit, got %d", peak)
+	}
+	pool.Close()
+}
+
+func TestAdaptiveLimiterQueued(t *testing.T) {
+	fmt.Println(t.Name())
+	pool := NewPoolWithOptions(WithCapacity(2), WithAdaptiveLimit(NewAIMDLimit(1, 1, 1)))
+	block := make(chan struct{})
+	var futures []Future
+	for i := 0; i < 4; i++ {
+		future, _ := pool.Submit(func() (interface{}, error) {
+			<-block
+			return nil, nil
+		})
+		futures = append(futures, future)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if stats := pool.(StatsReporter).Stats(); stats.Running != 1 || stats.Queued < 2 {
+		t.Errorf("tasks waiting for permits should be queued without holding workers, got %d/%d", stats.Running, stats.Queued)
+	}
+	close(block)
+	for _, future := range futures {
+		_, _ = future.Value()
+	}
+	pool.Close()
+}
@@ -0,0 +1,130 @@
+package pond
+
+import (
+	"context"
+	"runtime/pprof"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// TaskOptions carries metadata of a task, which is attached to profiles,
+// hooks, stats and Future of the task.
+type TaskOptions struct {
+	// Name is the kind of task, tasks of the same name are counted
+	// together in Stats.Tasks.
+	Name string
+
+	// ID identify the task, it is generated if empty.
+	ID string
+
+	// Labels are attached to goroutine running the task as pprof labels,
+	// in addition to "task_name" and "task_id".
+	Labels map[string]string
+}
+
+// TaskHook is invoked with metadata, execution duration and error of
+// every task after it done, meta is zero for tasks submitted without
+// TaskOptions, see WithTaskHook.
+type TaskHook func(meta TaskOptions, elapsed time.Duration, err error)
+
+// MetadataSubmitter is implemented by pools accepting tasks with metadata.
+// FixedFuncPool and BatchFuncPool do not implement it, their tasks are
+// submitted as arguments of the fixed function.
+type MetadataSubmitter interface {
+	// SubmitNamed submit a new task with name, see TaskOptions.
+	SubmitNamed(name string, task Task) (Future, error)
+
+	// SubmitWithOptions submit a new task with metadata.
+	SubmitWithOptions(task Task, opts TaskOptions) (Future, error)
+}
+
+// IdentifiedFuture is implemented by Futures of tasks carrying IDs, e.g.
+// submitted by MetadataSubmitter.
+type IdentifiedFuture interface {
+	Future
+
+	// ID return the ID of task, see TaskOptions. It is empty for tasks
+	// submitted without TaskOptions.
+	ID() string
+}
+
+var _ IdentifiedFuture = (*pondFuture)(nil)
+
+// taskSeq generate IDs of tasks submitted without ID.
+var taskSeq uint64
+
+func nextTaskID() string {
+	return strconv.FormatUint(atomic.AddUint64(&taskSeq, 1), 10)
+}
+
+// SubmitNamed submit a new task with name, it is short for
+// SubmitWithOptions(task, TaskOptions{Name: name}).
+func (bp *basicPool) SubmitNamed(name string, task Task) (Future, error) {
+	return bp.SubmitWithOptions(task, TaskOptions{Name: name})
+}
+
+// SubmitWithOptions submit a new task with metadata, the ID of task is
+// exposed by IdentifiedFuture.
+func (bp *basicPool) SubmitWithOptions(task Task, opts TaskOptions) (Future, error) {
+	if opts.ID == "" {
+		opts.ID = nextTaskID()
+	}
+	te := rscPool.GetTask(statelessTask(task), nil)
+	te.meta = &opts
+	return bp.submit(te, -1)
+}
+
+// wrap chain task of te with middlewares of pool and track it by stats.
+// Tasks are reported to hook, tasks with metadata run under pprof labels
+// and are tracked by task registry, sub-pools leave them to their parent.
+func (bp *basicPool) wrap(te *TaskEnvelope) Task {
+	task := bp.stats.track(te, chain(te.t, bp.middlewares))
+	if bp.parent != nil {
+		return task
+	}
+	meta := te.meta
+	if meta != nil {
+		task = labeled(meta, task)
+	}
+	if bp.hook != nil {
+		task = hooked(bp.hook, meta, task)
+	}
+	if meta != nil && bp.tasks != nil {
+		task = bp.tasks.track(meta.ID, task)
+	}
+	return task
+}
+
+// labeled run task under pprof labels of meta.
+func labeled(meta *TaskOptions, task Task) Task {
+	return func() (val interface{}, err error) {
+		pprof.Do(context.Background(), meta.labels(), func(context.Context) {
+			val, err = task()
+		})
+		return val, err
+	}
+}
+
+// hooked report task to hook after done, meta can be nil.
+func hooked(hook TaskHook, meta *TaskOptions, task Task) Task {
+	return func() (interface{}, error) {
+		beg := time.Now()
+		val, err := task()
+		var opts TaskOptions
+		if meta != nil {
+			opts = *meta
+		}
+		hook(opts, time.Since(beg), err)
+		return val, err
+	}
+}
+
+func (meta *TaskOptions) labels() pprof.LabelSet {
+	args := make([]string, 0, 4+2*len(meta.Labels))
+	args = append(args, "task_name", meta.Name, "task_id", meta.ID)
+	for k, v := range meta.Labels {
+		args = append(args, k, v)
+	}
+	return pprof.Labels(args...)
+}
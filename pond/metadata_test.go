@@ -0,0 +1,105 @@
+package pond
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"runtime/pprof"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSubmitWithOptions(t *testing.T) {
+	fmt.Println(t.Name())
+	hooked := make(chan TaskOptions, 3)
+	pool := NewPoolWithOptions(WithCapacity(2), WithTaskHook(func(meta TaskOptions, elapsed time.Duration, err error) {
+		hooked <- meta
+	}))
+	defer pool.Close()
+	submitter := pool.(MetadataSubmitter)
+
+	future, err := submitter.SubmitWithOptions(func() (interface{}, error) {
+		var buf bytes.Buffer
+		_ = pprof.Lookup("goroutine").WriteTo(&buf, 1)
+		return buf.String(), nil
+	}, TaskOptions{Name: "resize", ID: "img-1", Labels: map[string]string{"tenant": "a"}})
+	if err != nil {
+		t.Error("task with options should be submitted:", err)
+		return
+	}
+	if id := future.(IdentifiedFuture).ID(); id != "img-1" {
+		t.Errorf("ID of task should be exposed by Future, got %s", id)
+	}
+	val, _ := future.Value()
+	for _, label := range []string{`"task_name":"resize"`, `"task_id":"img-1"`, `"tenant":"a"`} {
+		if !bytes.Contains([]byte(val.(string)), []byte(label)) {
+			t.Errorf("task should run under pprof label %s", label)
+		}
+	}
+	if meta := <-hooked; meta.Name != "resize" || meta.ID != "img-1" {
+		t.Errorf("metadata of task should be passed to hook, got %+v", meta)
+	}
+
+	future, _ = submitter.SubmitNamed("resize", func() (interface{}, error) {
+		return nil, errors.New("bad image")
+	})
+	if id := future.(IdentifiedFuture).ID(); id == "" || id == "img-1" {
+		t.Errorf("ID of task should be generated, got %q", id)
+	}
+	_, _ = future.Value()
+	<-hooked
+
+	future, _ = pool.Submit(func() (interface{}, error) { return nil, nil })
+	if id := future.(IdentifiedFuture).ID(); id != "" {
+		t.Errorf("task without options should have no ID, got %s", id)
+	}
+	_, _ = future.Value()
+	if meta := <-hooked; meta.Name != "" || meta.ID != "" {
+		t.Errorf("task without options should be passed to hook with zero metadata, got %+v", meta)
+	}
+
+	stats := pool.(StatsReporter).Stats()
+	if named := stats.Tasks["resize"]; named.Completed != 1 || named.Failed != 1 || named.Running != 0 {
+		t.Errorf("stats should break down by task names, got %+v", named)
+	}
+	if stats.Completed != 2 || len(stats.Tasks) != 1 {
+		t.Errorf("stats should count all tasks, got %+v", stats)
+	}
+}
+
+func TestSubmitWithOptionsNameLimit(t *testing.T) {
+	fmt.Println(t.Name())
+	pool := NewPoolWithOptions(WithCapacity(2))
+	defer pool.Close()
+	submitter := pool.(MetadataSubmitter)
+	for i := 0; i <= defaultMaxTaskNames; i++ {
+		future, _ := submitter.SubmitNamed(strconv.Itoa(i), func() (interface{}, error) { return nil, nil })
+		_, _ = future.Value()
+	}
+	stats := pool.(StatsReporter).Stats()
+	if len(stats.Tasks) != defaultMaxTaskNames || stats.Completed != defaultMaxTaskNames+1 {
+		t.Errorf("task names beyond limit should be counted in total only, got %d names", len(stats.Tasks))
+	}
+}
+
+func TestRunningTaskMetadata(t *testing.T) {
+	fmt.Println(t.Name())
+	pool := NewPoolWithOptions(WithCapacity(1), WithRunningTasks())
+	defer pool.Close()
+	release, started := make(chan struct{}), make(chan struct{})
+	future, _ := pool.(MetadataSubmitter).SubmitWithOptions(func() (interface{}, error) {
+		close(started)
+		<-release
+		return nil, nil
+	}, TaskOptions{Name: "sync", Labels: map[string]string{"shard": "3"}})
+	<-started
+
+	tasks := pool.(TaskInspector).RunningTasks()
+	close(release)
+	_, _ = future.Value()
+	id := future.(IdentifiedFuture).ID()
+	if len(tasks) != 1 || tasks[0].Name != "sync" || tasks[0].ID != id || tasks[0].Labels["shard"] != "3" {
+		t.Errorf("metadata of running task should be listed, got %+v", tasks)
+	}
+}
@@ -0,0 +1,73 @@
+package pond
+
+import (
+	"fmt"
+	"time"
+)
+
+// Middleware decorates a Task with cross-cutting behaviors, such as
+// logging, recovery and timing. It receives the next Task in chain and
+// return a new one wrapping it.
+type Middleware func(next Task) Task
+
+// chain wrap task with middlewares, mws[0] is the outermost one.
+func chain(task Task, mws []Middleware) Task {
+	for i := len(mws) - 1; i >= 0; i-- {
+		task = mws[i](task)
+	}
+	return task
+}
+
+// RecoveryMiddleware recover the panic raised by task and turn it into
+// an error wrapping ErrTaskPanicked, so that the worker survives.
+func RecoveryMiddleware() Middleware {
+	return func(next Task) Task {
+		return func() (val interface{}, err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					val, err = nil, fmt.Errorf("%w: %v", ErrTaskPanicked, r)
+				}
+			}()
+			return next()
+		}
+	}
+}
+
+// TimingMiddleware invoke hook with the execution duration and error
+// of every task after it done.
+func TimingMiddleware(hook func(elapsed time.Duration, err error)) Middleware {
+	return func(next Task) Task {
+		return func() (interface{}, error) {
+			beg := time.Now()
+			val, err := next()
+			hook(time.Since(beg), err)
+			return val, err
+		}
+	}
+}
+
+// DeadlineMiddleware limit the execution duration of task, ErrTaskDeadline
+// returned once exceeded. The task itself can not be interrupted, it keeps
+// running in background and its return values are dropped. It may still
+// use the worker state then, see WithWorkerState.
+func DeadlineMiddleware(d time.Duration) Middleware {
+	return func(next Task) Task {
+		return func() (interface{}, error) {
+			// buffered, the background task never blocks on sending.
+			done := make(chan *taskResult, 1)
+			go func() {
+				val, err := next()
+				done <- &taskResult{val: val, err: err}
+			}()
+
+			timer := time.NewTimer(d)
+			defer timer.Stop()
+			select {
+			case res := <-done:
+				return res.val, res.err
+			case <-timer.C:
+				return nil, ErrTaskDeadline
+			}
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package pond
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestMiddlewareOrder(t *testing.T) {
+	fmt.Println(t.Name())
+	var trace []string
+	tag := func(name string) Middleware {
+		return func(next Task) Task {
+			return func() (interface{}, error) {
+				trace = append(trace, name)
+				return next()
+			}
+		}
+	}
+	pool := NewPoolWithOptions(WithCapacity(1), WithMiddleware(tag("a"), tag("b")))
+	future, _ := pool.Submit(func() (interface{}, error) {
+		trace = append(trace, "task")
+		return nil, nil
+	})
+	_, _ = future.Value()
+	if fmt.Sprint(trace) != "[a b task]" {
+		t.Errorf("middlewares should be applied in order, got %v", trace)
+	}
+	pool.Close()
+}
+
+func TestRecoveryMiddleware(t *testing.T) {
+	fmt.Println(t.Name())
+	pool := NewFixedFuncPoolWithOptions(func(interface{}) (interface{}, error) {
+		panic("boom")
+	}, WithCapacity(1), WithMiddleware(RecoveryMiddleware()))
+	future, _ := pool.Submit(1)
+	if _, err := future.Value(); !errors.Is(err, ErrTaskPanicked) {
+		t.Errorf("panic should be recovered as ErrTaskPanicked, got %v", err)
+	}
+	pool.Close()
+}
+
+func TestTimingAndDeadlineMiddleware(t *testing.T) {
+	fmt.Println(t.Name())
+	timed := make(chan error, 1)
+	pool := NewPoolWithOptions(WithCapacity(1), WithMiddleware(
+		TimingMiddleware(func(elapsed time.Duration, err error) { timed <- err }),
+		DeadlineMiddleware(10*time.Millisecond),
+	))
+	future, _ := pool.Submit(func() (interface{}, error) {
+		time.Sleep(100 * time.Millisecond)
+		return nil, nil
+	})
+	if _, err := future.Value(); err != ErrTaskDeadline {
+		t.Errorf("task should exceed its deadline, got %v", err)
+	}
+	if err := <-timed; err != ErrTaskDeadline {
+		t.Errorf("timing hook should observe ErrTaskDeadline, got %v", err)
+	}
+	pool.Close()
+}
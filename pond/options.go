@@ -0,0 +1,217 @@
+package pond
+
+// Option configures optional behaviors of a pool, it is applied on
+// pool construction.
+type Option func(*options)
+
+type options struct {
+	capacity    int
+	workerCtor  WorkerCtor
+	middlewares []Middleware
+	hook        TaskHook
+
+	errorHandler func(error)
+
+	stateInit    func() (interface{}, error)
+	stateCleanup func(interface{})
+
+	lockOSThread bool
+	cpus         []int
+
+	clock     Clock
+	limitAlgo LimitAlgorithm
+
+	rate  float64
+	burst int
+
+	breaker *BreakerConfig
+	dedup   func(arg interface{}) string
+	cache   *CacheConfig
+
+	runningTasks bool
+	watchdog     *WatchdogConfig
+
+	taskRetention int
+
+	durable *DurableConfig
+}
+
+func newOptions(opts ...Option) *options {
+	o := &options{
+		capacity: DefaultCapacity(),
+		clock:    systemClock{},
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithCapacity set the initial number of workers of pool.
+func WithCapacity(cap int) Option {
+	return func(o *options) {
+		o.capacity = cap
+	}
+}
+
+// WithWorkerCtor make pool create workers by user-customized worker
+// constructor instead of the default one.
+func WithWorkerCtor(wc WorkerCtor) Option {
+	return func(o *options) {
+		o.workerCtor = wc
+	}
+}
+
+// WithMiddleware append middlewares to pool, every submitted task will
+// be wrapped by them in order, the first one is the outermost.
+func WithMiddleware(mws ...Middleware) Option {
+	return func(o *options) {
+		o.middlewares = append(o.middlewares, mws...)
+	}
+}
+
+// WithTaskHook make pool invoke hook after every task done, such as for
+// tracing and logging, see TaskHook.
+func WithTaskHook(hook TaskHook) Option {
+	return func(o *options) {
+		o.hook = hook
+	}
+}
+
+// WithErrorHandler make pool pass errors raised in background to handler,
+// such as workers failed to initialize, errors are dropped if not set.
+// It may be invoked concurrently and with locks of pool held, so it must
+// not call methods of pool.
+func WithErrorHandler(handler func(err error)) Option {
+	return func(o *options) {
+		o.errorHandler = handler
+	}
+}
+
+// WithWorkerState make every worker own a state created by init, such
+// as a scratch buffer or a DB connection, which is reused across tasks
+// submitted by StatefulSubmitter. cleanup is invoked with the state after
+// worker closed, it can be nil. It works with the default worker only.
+//
+// A task timed out by DeadlineMiddleware keeps running in background
+// while its worker moves on to the next task with the same state, so
+// the state may be used by both tasks at once. Use states safe for
+// concurrent use along with DeadlineMiddleware.
+func WithWorkerState(init func() (interface{}, error), cleanup func(interface{})) Option {
+	return func(o *options) {
+		o.stateInit, o.stateCleanup = init, cleanup
+	}
+}
+
+// WithLockOSThread make every worker locked to its own OS thread for
+// its lifetime, which is required by cgo and thread-affine libraries,
+// Init of worker and WithWorkerState init also run on the locked thread.
+// If cpus given, worker threads are also pinned to the cpu set on linux,
+// pinning is best-effort, failures such as ErrInvalidCPU are passed to
+// handler of WithErrorHandler and the worker runs unpinned.
+func WithLockOSThread(cpus ...int) Option {
+	return func(o *options) {
+		o.lockOSThread, o.cpus = true, cpus
+	}
+}
+
+// WithClock replace the clock used by time-driven behaviors of pool, such
+// as latency measurement of adaptive limit, it is for testing mostly.
+func WithClock(c Clock) Option {
+	return func(o *options) {
+		o.clock = c
+	}
+}
+
+// WithAdaptiveLimit limit the number of concurrently running tasks by
+// algo, which adjusts the limit by task latency, see AIMDLimit and
+// VegasLimit. The limit never exceeds the number of workers, tasks
+// waiting for permits are queued without holding workers.
+func WithAdaptiveLimit(algo LimitAlgorithm) Option {
+	return func(o *options) {
+		o.limitAlgo = algo
+	}
+}
+
+// WithRateLimit limit the pace of pool starting tasks by a token bucket
+// refilled at rate tokens per second and holding at most burst tokens.
+// Every task costs one token unless submitted by SubmitWithCost, tasks
+// waiting for tokens are queued without holding workers. A burst less
+// than one is taken as one.
+func WithRateLimit(rate float64, burst int) Option {
+	return func(o *options) {
+		if burst < 1 {
+			burst = 1
+		}
+		o.rate, o.burst = rate, burst
+	}
+}
+
+// WithCircuitBreaker guard the fixed function of FixedFuncPool by a
+// circuit breaker configured by cfg, it is ignored by other pools.
+func WithCircuitBreaker(cfg BreakerConfig) Option {
+	return func(o *options) {
+		o.breaker = &cfg
+	}
+}
+
+// WithDedupKey coalesce submissions of FixedFuncPool with the same key
+// computed by key: while a call is queued or running, submissions with
+// its key get its Future instead of enqueueing another call, like
+// singleflight. It is ignored by other pools.
+func WithDedupKey(key func(arg interface{}) string) Option {
+	return func(o *options) {
+		o.dedup = key
+	}
+}
+
+// WithResultCache memoize results of FixedFuncPool in a cache configured
+// by cfg, cache hits return a completed Future without queueing a call.
+// Cache is invalidated when fixed function replaced. It is ignored by
+// other pools.
+func WithResultCache(cfg CacheConfig) Option {
+	return func(o *options) {
+		o.cache = &cfg
+	}
+}
+
+// WithRunningTasks make pool track tasks under execution, so that they
+// are listed by TaskInspector. Tracking takes a lock per task, it is
+// enabled by WithWatchdog too.
+func WithRunningTasks() Option {
+	return func(o *options) {
+		o.runningTasks = true
+	}
+}
+
+// WithWatchdog make pool watch for tasks running longer than threshold of
+// cfg, see WatchdogConfig.
+func WithWatchdog(cfg WatchdogConfig) Option {
+	return func(o *options) {
+		o.watchdog = &cfg
+	}
+}
+
+// WithTaskRegistry make pool track tasks submitted by Submit methods by
+// their IDs, tasks without TaskOptions get generated IDs. At most
+// retention finished tasks are kept, default is defaultTaskRetention if
+// retention is not positive, see TaskTracker. Tasks accepted by background
+// goroutines, e.g. of tenants, sub-pools, streams and batches, are not
+// tracked.
+func WithTaskRegistry(retention int) Option {
+	return func(o *options) {
+		if retention <= 0 {
+			retention = defaultTaskRetention
+		}
+		o.taskRetention = retention
+	}
+}
+
+// WithDurableQueue make pool accept durable tasks by SubmitDurable, they
+// are logged in write-ahead log under cfg.Dir and replayed by Replay
+// after restart until done, see DurableSubmitter.
+func WithDurableQueue(cfg DurableConfig) Option {
+	return func(o *options) {
+		o.durable = &cfg
+	}
+}
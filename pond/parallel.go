@@ -0,0 +1,243 @@
+package pond
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// ParallelOption configures parallel collection helpers, see Map.
+type ParallelOption func(*parallelOptions)
+
+type parallelOptions struct {
+	chunkSize  int
+	collectAll bool
+}
+
+// WithChunkSize set the number of items processed by one task, default
+// chunk size splits items into 4 chunks per worker of pool.
+func WithChunkSize(size int) ParallelOption {
+	return func(o *parallelOptions) {
+		o.chunkSize = size
+	}
+}
+
+// CollectErrors make helpers process all items rather than stop on the
+// first error, errors of items are returned together as MultiError.
+func CollectErrors() ParallelOption {
+	return func(o *parallelOptions) {
+		o.collectAll = true
+	}
+}
+
+// MultiError is the errors of items collected by CollectErrors, in order
+// of items.
+type MultiError []error
+
+func (me MultiError) Error() string {
+	msgs := make([]string, 0, len(me))
+	for _, err := range me {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Map call fn with every item on pool, and return results in order of
+// items. It stops on the first error and cancels ctx passed to fn,
+// unless CollectErrors given.
+func Map(ctx context.Context, pool Pool, items []interface{}, fn func(ctx context.Context, item interface{}) (interface{}, error), opts ...ParallelOption) ([]interface{}, error) {
+	results := make([]interface{}, len(items))
+	err := parallel(ctx, pool, len(items), func(ctx context.Context, i int) error {
+		val, err := fn(ctx, items[i])
+		results[i] = val
+		return err
+	}, opts)
+	if err != nil {
+		if _, ok := err.(MultiError); !ok {
+			return nil, err
+		}
+	}
+	return results, err
+}
+
+// ForEach call fn with every item on pool, it stops on the first error
+// and cancels ctx passed to fn, unless CollectErrors given.
+func ForEach(ctx context.Context, pool Pool, items []interface{}, fn func(ctx context.Context, item interface{}) error, opts ...ParallelOption) error {
+	return parallel(ctx, pool, len(items), func(ctx context.Context, i int) error {
+		return fn(ctx, items[i])
+	}, opts)
+}
+
+// Filter return items accepted by fn in order, fn is called on pool. It
+// stops on the first error and cancels ctx passed to fn, unless
+// CollectErrors given.
+func Filter(ctx context.Context, pool Pool, items []interface{}, fn func(ctx context.Context, item interface{}) (bool, error), opts ...ParallelOption) ([]interface{}, error) {
+	keep := make([]bool, len(items))
+	err := parallel(ctx, pool, len(items), func(ctx context.Context, i int) error {
+		ok, err := fn(ctx, items[i])
+		keep[i] = ok
+		return err
+	}, opts)
+	if err != nil {
+		if _, ok := err.(MultiError); !ok {
+			return nil, err
+		}
+	}
+	var filtered []interface{}
+	for i, item := range items {
+		if keep[i] {
+			filtered = append(filtered, item)
+		}
+	}
+	return filtered, err
+}
+
+// Reduce combine items by fn on pool, fn must be associative because
+// every chunk is reduced on its own and then chunks are combined in
+// order. It returns nil for empty items. It stops on the first error and
+// cancels ctx passed to fn, CollectErrors is ignored.
+func Reduce(ctx context.Context, pool Pool, items []interface{}, fn func(ctx context.Context, acc, item interface{}) (interface{}, error), opts ...ParallelOption) (interface{}, error) {
+	if len(items) == 0 {
+		return nil, nil
+	}
+	o := newParallelOptions(pool, len(items), opts)
+	o.collectAll = false
+
+	chunks := (len(items) + o.chunkSize - 1) / o.chunkSize
+	partials := make([]interface{}, chunks)
+	err := parallelChunks(ctx, pool, len(items), o, func(ctx context.Context, beg, end int) error {
+		acc := items[beg]
+		for i := beg + 1; i < end; i++ {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			var err error
+			if acc, err = fn(ctx, acc, items[i]); err != nil {
+				return err
+			}
+		}
+		partials[beg/o.chunkSize] = acc
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	acc := partials[0]
+	for _, partial := range partials[1:] {
+		if acc, err = fn(ctx, acc, partial); err != nil {
+			return nil, err
+		}
+	}
+	return acc, nil
+}
+
+func newParallelOptions(pool Pool, n int, opts []ParallelOption) *parallelOptions {
+	o := &parallelOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.chunkSize <= 0 {
+		chunks := 4 * pool.Workers()
+		if chunks < 1 {
+			chunks = 1
+		}
+		o.chunkSize = (n + chunks - 1) / chunks
+		if o.chunkSize < 1 {
+			o.chunkSize = 1
+		}
+	}
+	return o
+}
+
+// parallel call fn with every index in [0, n) on pool by chunks.
+func parallel(ctx context.Context, pool Pool, n int, fn func(ctx context.Context, i int) error, opts []ParallelOption) error {
+	o := newParallelOptions(pool, n, opts)
+	if !o.collectAll {
+		return parallelChunks(ctx, pool, n, o, func(ctx context.Context, beg, end int) error {
+			for i := beg; i < end; i++ {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				if err := fn(ctx, i); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+
+	errs := make([]error, n)
+	err := parallelChunks(ctx, pool, n, o, func(ctx context.Context, beg, end int) error {
+		for i := beg; i < end; i++ {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			errs[i] = fn(ctx, i)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	var me MultiError
+	for _, err := range errs {
+		if err != nil {
+			me = append(me, err)
+		}
+	}
+	if len(me) > 0 {
+		return me
+	}
+	return nil
+}
+
+// parallelChunks submit a task to pool for every chunk of [0, n), and
+// wait for all of them. The first error cancels the rest chunks and is
+// returned, it is ctx.Err() if ctx done first.
+func parallelChunks(ctx context.Context, pool Pool, n int, o *parallelOptions, fn func(ctx context.Context, beg, end int) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		once     sync.Once
+		firstErr error
+	)
+	fail := func(err error) {
+		once.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	futures := make([]Future, 0, (n+o.chunkSize-1)/o.chunkSize)
+	for beg := 0; beg < n; beg += o.chunkSize {
+		// rest chunks are not submitted once failed or ctx done.
+		if err := ctx.Err(); err != nil {
+			fail(err)
+			break
+		}
+		end := beg + o.chunkSize
+		if end > n {
+			end = n
+		}
+		beg := beg
+		fut, err := pool.Submit(func() (interface{}, error) {
+			if err := fn(ctx, beg, end); err != nil {
+				fail(err)
+			}
+			return nil, nil
+		})
+		if err != nil {
+			fail(err)
+			break
+		}
+		futures = append(futures, fut)
+	}
+	for _, fut := range futures {
+		if _, err := fut.Value(); err != nil {
+			fail(err)
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,158 @@
+package pond
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+func ints(n int) []interface{} {
+	items := make([]interface{}, n)
+	for i := range items {
+		items[i] = i
+	}
+	return items
+}
+
+func TestMap(t *testing.T) {
+	fmt.Println(t.Name())
+	pool := NewPool(4)
+	defer pool.Close()
+
+	results, err := Map(context.Background(), pool, ints(1000), func(ctx context.Context, item interface{}) (interface{}, error) {
+		return item.(int) * 2, nil
+	})
+	if err != nil {
+		t.Error("items should be mapped:", err)
+	}
+	for i, res := range results {
+		if res != 2*i {
+			t.Errorf("results should be in order of items, expect %d at %d, got %v", 2*i, i, res)
+			break
+		}
+	}
+}
+
+func TestMapStopOnFirstError(t *testing.T) {
+	fmt.Println(t.Name())
+	pool := NewPool(4)
+	defer pool.Close()
+
+	errBad := errors.New("bad item")
+	var called int32
+	_, err := Map(context.Background(), pool, ints(1000), func(ctx context.Context, item interface{}) (interface{}, error) {
+		atomic.AddInt32(&called, 1)
+		if item.(int) == 10 {
+			return nil, errBad
+		}
+		return item, nil
+	}, WithChunkSize(1))
+	if err != errBad {
+		t.Error("the first error should be returned")
+	}
+	if called := atomic.LoadInt32(&called); called == 1000 {
+		t.Error("rest items should be cancelled after error")
+	}
+}
+
+func TestMapStopSubmitting(t *testing.T) {
+	fmt.Println(t.Name())
+	pool := NewPool(1)
+	defer pool.Close()
+
+	errBad := errors.New("bad item")
+	_, err := Map(context.Background(), pool, ints(1000), func(ctx context.Context, item interface{}) (interface{}, error) {
+		return nil, errBad
+	}, WithChunkSize(1))
+	if err != errBad {
+		t.Error("the first error should be returned")
+	}
+	if submitted := pool.(StatsReporter).Stats().Submitted; submitted == 1000 {
+		t.Error("rest chunks should not be submitted after error")
+	}
+}
+
+func TestForEachCollectErrors(t *testing.T) {
+	fmt.Println(t.Name())
+	pool := NewPool(4)
+	defer pool.Close()
+
+	var called int32
+	err := ForEach(context.Background(), pool, ints(100), func(ctx context.Context, item interface{}) error {
+		atomic.AddInt32(&called, 1)
+		if item.(int)%10 == 0 {
+			return errors.New("bad item")
+		}
+		return nil
+	}, CollectErrors())
+	if me, ok := err.(MultiError); !ok || len(me) != 10 {
+		t.Errorf("errors of items should be collected, got %v", err)
+	}
+	if called != 100 {
+		t.Errorf("all items should be processed, got %d", called)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	fmt.Println(t.Name())
+	pool := NewPool(4)
+	defer pool.Close()
+
+	filtered, err := Filter(context.Background(), pool, ints(100), func(ctx context.Context, item interface{}) (bool, error) {
+		return item.(int)%3 == 0, nil
+	})
+	if err != nil {
+		t.Error("items should be filtered:", err)
+	}
+	if len(filtered) != 34 {
+		t.Errorf("34 items should be kept, got %d", len(filtered))
+	}
+	for i, item := range filtered {
+		if item != 3*i {
+			t.Errorf("kept items should be in order, expect %d at %d, got %v", 3*i, i, item)
+			break
+		}
+	}
+}
+
+func TestReduce(t *testing.T) {
+	fmt.Println(t.Name())
+	pool := NewPool(4)
+	defer pool.Close()
+
+	sum, err := Reduce(context.Background(), pool, ints(101), func(ctx context.Context, acc, item interface{}) (interface{}, error) {
+		return acc.(int) + item.(int), nil
+	}, WithChunkSize(7))
+	if err != nil || sum != 5050 {
+		t.Errorf("sum of items should be 5050, got %v %v", sum, err)
+	}
+	if res, err := Reduce(context.Background(), pool, nil, nil); res != nil || err != nil {
+		t.Errorf("reducing empty items should return nil, got %v %v", res, err)
+	}
+}
+
+func TestParallelContextCancelled(t *testing.T) {
+	fmt.Println(t.Name())
+	pool := NewPool(2)
+	defer pool.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := ForEach(ctx, pool, ints(10), func(ctx context.Context, item interface{}) error {
+		return nil
+	})
+	if err != context.Canceled {
+		t.Error("cancelled ctx should be reported")
+	}
+	if submitted := pool.(StatsReporter).Stats().Submitted; submitted != 0 {
+		t.Errorf("no chunks should be submitted with cancelled ctx, got %d", submitted)
+	}
+
+	closed := NewPool(1)
+	closed.Close()
+	if _, err := Map(context.Background(), closed, ints(10), nil); err != ErrPoolClosed {
+		t.Error("closed pool should be reported")
+	}
+}
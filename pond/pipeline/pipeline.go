@@ -0,0 +1,322 @@
+// Package pipeline compose FixedFuncPools into stages, the output of a
+// stage feeds the next one through a bounded buffer.
+//
+// Every input of a stage is processed by its own goroutine, so outputs of a
+// stage with Capacity > 1 are not in order of its inputs. Output must be
+// consumed until closed, otherwise the last stage blocks and holds back all
+// stages before it, see Close for aborting a stuck pipeline.
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"pond/pond"
+)
+
+// defaultBuffer is the default size of buffer feeding a stage.
+const defaultBuffer = 16
+
+var (
+	ErrNoStages       = errors.New("pipeline: no stages")
+	ErrNilFunc        = errors.New("pipeline: stage without func")
+	ErrPipelineClosed = errors.New("pipeline: pipeline has been closed")
+	// ErrPipelineAborted is the error of dead letters of inputs not done
+	// when Close aborted the pipeline.
+	ErrPipelineAborted = errors.New("pipeline: pipeline has been aborted")
+)
+
+// Stage is a step of pipeline, every input is passed to Func on a
+// FixedFuncPool owned by the stage.
+type Stage struct {
+	Name string
+	Func pond.FixedFunc
+
+	// Capacity is the number of workers of stage, which is also the max
+	// number of inputs processed concurrently, default is NumCPU.
+	Capacity int
+
+	// Buffer is the size of buffer feeding the stage, default is
+	// defaultBuffer.
+	Buffer int
+
+	// Options configure the pool of stage in addition to Capacity.
+	Options []pond.Option
+}
+
+// Items fan out the output of a stage, a stage returning Items passes
+// every item to the next stage separately. It is the only way of fan-out,
+// outputs of other types, slices included, are passed as a whole.
+type Items []interface{}
+
+// DeadLetter is an input failed by a stage.
+type DeadLetter struct {
+	Stage string
+	Input interface{}
+	Err   error
+}
+
+// StageStats is statistics of a stage, inputs fanned out by the previous
+// stage are counted separately.
+type StageStats struct {
+	Name string
+	// In is the number of inputs received by stage.
+	In uint64
+	// Out is the number of outputs passed to the next stage.
+	Out uint64
+	// Failed is the number of inputs routed to dead-letter sink.
+	Failed uint64
+	Pool   pond.Stats
+}
+
+// Option configures optional behaviors of Pipeline.
+type Option func(*Pipeline)
+
+// WithDeadLetter route inputs failed by stages to sink, they are dropped
+// by default. sink is invoked concurrently by stages.
+func WithDeadLetter(sink func(DeadLetter)) Option {
+	return func(p *Pipeline) {
+		p.deadLetter = sink
+	}
+}
+
+// Pipeline chains stages, inputs pushed in flow through stages and come
+// out from Output.
+type Pipeline struct {
+	stages     []*stage
+	out        chan interface{}
+	deadLetter func(DeadLetter)
+
+	// mu guards sending to the first stage against closing.
+	mu        sync.RWMutex
+	closed    bool
+	closing   chan struct{}
+	closeOnce sync.Once
+	feeders   sync.WaitGroup
+	running   sync.WaitGroup
+	// drained is closed after stages done and their pools closed.
+	drained chan struct{}
+	// aborted is closed once Close gives up draining.
+	aborted   chan struct{}
+	abortOnce sync.Once
+}
+
+type stage struct {
+	name string
+	pool *pond.FixedFuncPool
+	in   chan interface{}
+	sem  chan struct{}
+
+	received uint64
+	sent     uint64
+	failed   uint64
+}
+
+// New return a new Pipeline chaining stages in order.
+func New(stages []Stage, opts ...Option) (*Pipeline, error) {
+	if len(stages) == 0 {
+		return nil, ErrNoStages
+	}
+	for _, s := range stages {
+		if s.Func == nil {
+			return nil, ErrNilFunc
+		}
+	}
+
+	p := &Pipeline{
+		out:     make(chan interface{}, defaultBuffer),
+		closing: make(chan struct{}),
+		drained: make(chan struct{}),
+		aborted: make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	for _, s := range stages {
+		capacity, buffer := s.Capacity, s.Buffer
+		if capacity <= 0 {
+			capacity = runtime.NumCPU()
+		}
+		if buffer <= 0 {
+			buffer = defaultBuffer
+		}
+		poolOpts := append([]pond.Option{pond.WithCapacity(capacity)}, s.Options...)
+		p.stages = append(p.stages, &stage{
+			name: s.Name,
+			pool: pond.NewFixedFuncPoolWithOptions(s.Func, poolOpts...),
+			in:   make(chan interface{}, buffer),
+			sem:  make(chan struct{}, capacity),
+		})
+	}
+	p.running.Add(len(p.stages))
+	for i, s := range p.stages {
+		next := p.out
+		if i+1 < len(p.stages) {
+			next = p.stages[i+1].in
+		}
+		go p.run(s, next)
+	}
+	return p, nil
+}
+
+// run pass inputs of stage to its pool and results to next, at most
+// capacity inputs are in flight, so a slow next stage holds back this one.
+// Once aborted, inputs left are routed to dead-letter sink without being
+// processed. next is closed after all inputs done.
+func (p *Pipeline) run(s *stage, next chan interface{}) {
+	var inflight sync.WaitGroup
+	for input := range s.in {
+		atomic.AddUint64(&s.received, 1)
+		select {
+		case <-p.aborted:
+			p.fail(s, input, ErrPipelineAborted)
+			continue
+		default:
+		}
+		s.sem <- struct{}{}
+		inflight.Add(1)
+		go func(input interface{}) {
+			defer func() {
+				<-s.sem
+				inflight.Done()
+			}()
+			fut, err := s.pool.Submit(input)
+			var val interface{}
+			if err == nil {
+				val, err = fut.Value()
+			}
+			if err != nil {
+				p.fail(s, input, err)
+				return
+			}
+			items, ok := val.(Items)
+			if !ok {
+				items = Items{val}
+			}
+			for _, item := range items {
+				select {
+				case next <- item:
+					atomic.AddUint64(&s.sent, 1)
+				case <-p.aborted:
+					// outputs of input are partially sent at most.
+					p.fail(s, input, ErrPipelineAborted)
+					return
+				}
+			}
+		}(input)
+	}
+	inflight.Wait()
+	close(next)
+	p.running.Done()
+}
+
+// fail count input as failed by stage and route it to dead-letter sink.
+func (p *Pipeline) fail(s *stage, input interface{}, err error) {
+	atomic.AddUint64(&s.failed, 1)
+	if p.deadLetter != nil {
+		p.deadLetter(DeadLetter{Stage: s.name, Input: input, Err: err})
+	}
+}
+
+// Push send input to the first stage, it blocks while the buffer of first
+// stage is full. ErrPipelineClosed returned after Close invoked.
+func (p *Pipeline) Push(input interface{}) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrPipelineClosed
+	}
+	select {
+	case p.stages[0].in <- input:
+		return nil
+	case <-p.closing:
+		return ErrPipelineClosed
+	}
+}
+
+// Feed push inputs received from src in background until src closed or
+// pipeline closed, multiple sources can be fed in concurrently.
+func (p *Pipeline) Feed(src <-chan interface{}) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return
+	}
+	p.feeders.Add(1)
+	go func() {
+		defer p.feeders.Done()
+		for {
+			select {
+			case input, ok := <-src:
+				if !ok || p.Push(input) != nil {
+					return
+				}
+			case <-p.closing:
+				return
+			}
+		}
+	}()
+}
+
+// Output return the channel of results of the last stage, it must be
+// consumed until closed, which happens after pipeline drained or aborted by
+// Close. Outputs are not in order of inputs pushed.
+func (p *Pipeline) Output() <-chan interface{} {
+	return p.out
+}
+
+// Close stop accepting inputs and drain the pipeline gracefully: inputs
+// pushed before are processed by all stages, then Output is closed and
+// pools of stages are closed. Close blocks until drained or ctx done.
+//
+// Once ctx done, e.g. Output is not consumed, the pipeline is aborted:
+// inputs not processed yet and outputs not sent yet are routed to
+// dead-letter sink with ErrPipelineAborted, then Close returns ctx.Err()
+// after funcs running returned.
+func (p *Pipeline) Close(ctx context.Context) error {
+	p.closeOnce.Do(func() {
+		// release pushes blocked on full buffer ahead of locking.
+		close(p.closing)
+		p.mu.Lock()
+		p.closed = true
+		p.mu.Unlock()
+
+		go func() {
+			p.feeders.Wait()
+			close(p.stages[0].in)
+			p.running.Wait()
+			for _, s := range p.stages {
+				s.pool.Close()
+			}
+			close(p.drained)
+		}()
+	})
+	select {
+	case <-p.drained:
+		return nil
+	case <-ctx.Done():
+		p.abortOnce.Do(func() {
+			close(p.aborted)
+		})
+		<-p.drained
+		return ctx.Err()
+	}
+}
+
+// Stats return statistics of stages in order.
+func (p *Pipeline) Stats() []StageStats {
+	stats := make([]StageStats, 0, len(p.stages))
+	for _, s := range p.stages {
+		stats = append(stats, StageStats{
+			Name:   s.name,
+			In:     atomic.LoadUint64(&s.received),
+			Out:    atomic.LoadUint64(&s.sent),
+			Failed: atomic.LoadUint64(&s.failed),
+			Pool:   s.pool.Stats(),
+		})
+	}
+	return stats
+}
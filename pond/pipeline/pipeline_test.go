@@ -0,0 +1,176 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"pond/pond"
+)
+
+func TestPipeline(t *testing.T) {
+	fmt.Println(t.Name())
+	errOdd := errors.New("odd")
+	var (
+		mu      sync.Mutex
+		letters []DeadLetter
+	)
+	p, err := New([]Stage{
+		{Name: "split", Capacity: 2, Func: func(arg interface{}) (interface{}, error) {
+			n := arg.(int)
+			return Items{n, n + 1}, nil
+		}},
+		{Name: "even", Capacity: 4, Buffer: 4, Func: func(arg interface{}) (interface{}, error) {
+			if arg.(int)%2 != 0 {
+				return nil, errOdd
+			}
+			return arg, nil
+		}},
+		{Name: "square", Func: func(arg interface{}) (interface{}, error) {
+			return arg.(int) * arg.(int), nil
+		}},
+	}, WithDeadLetter(func(dl DeadLetter) {
+		mu.Lock()
+		letters = append(letters, dl)
+		mu.Unlock()
+	}))
+	if err != nil {
+		t.Error("pipeline should be created:", err)
+		return
+	}
+
+	// fan in two sources.
+	for beg := 0; beg < 100; beg += 50 {
+		src := make(chan interface{})
+		go func(beg int) {
+			defer close(src)
+			for i := beg; i < beg+50; i++ {
+				src <- i
+			}
+		}(beg)
+		p.Feed(src)
+	}
+
+	var (
+		sum   int
+		count int
+		done  = make(chan struct{})
+	)
+	go func() {
+		defer close(done)
+		for out := range p.Output() {
+			sum += out.(int)
+			count++
+		}
+	}()
+
+	// every input n yields exactly one even number of n and n+1.
+	for p.Stats()[2].Out < 100 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := p.Push(100); err != nil {
+		t.Error("input should be pushed:", err)
+	}
+	if err := p.Close(context.Background()); err != nil {
+		t.Error("pipeline should be drained:", err)
+	}
+	<-done
+
+	if err := p.Push(1); err != ErrPipelineClosed {
+		t.Error("input should not be pushed after pipeline closed")
+	}
+	if count != 101 {
+		t.Errorf("every input should have an output, got %d", count)
+	}
+	expect := 0
+	for i := 0; i <= 100; i++ {
+		even := i
+		if even%2 != 0 {
+			even++
+		}
+		expect += even * even
+	}
+	if sum != expect {
+		t.Errorf("sum of outputs should be %d, got %d", expect, sum)
+	}
+	if len(letters) != 101 || letters[0].Stage != "even" || letters[0].Err != errOdd {
+		t.Errorf("failed inputs should be routed to dead-letter sink, got %d", len(letters))
+	}
+
+	stats := p.Stats()
+	if stats[0].In != 101 || stats[0].Out != 202 || stats[1].In != 202 || stats[1].Failed != 101 || stats[2].Out != 101 {
+		t.Errorf("stats should count inputs and outputs of stages, got %+v", stats)
+	}
+	if stats[1].Pool.Completed != 101 {
+		t.Errorf("stats should include pool of stage, got %d completed", stats[1].Pool.Completed)
+	}
+}
+
+func TestPipelineAbort(t *testing.T) {
+	fmt.Println(t.Name())
+	var (
+		mu      sync.Mutex
+		letters []DeadLetter
+	)
+	p, _ := New([]Stage{
+		{Name: "echo", Capacity: 2, Buffer: 2, Func: func(arg interface{}) (interface{}, error) {
+			return arg, nil
+		}},
+	}, WithDeadLetter(func(dl DeadLetter) {
+		mu.Lock()
+		letters = append(letters, dl)
+		mu.Unlock()
+	}))
+	// Output is never consumed, the stage is stuck once buffers full.
+	pushed := make(chan int)
+	go func() {
+		n := 0
+		for p.Push(n) == nil {
+			n++
+		}
+		pushed <- n
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := p.Close(ctx); err != context.DeadlineExceeded {
+		t.Error("pipeline should be aborted once ctx done")
+	}
+	n := <-pushed
+	stats := p.Stats()
+	if int(stats[0].In) != n || stats[0].Out+stats[0].Failed != stats[0].In || stats[0].Failed == 0 || len(letters) != int(stats[0].Failed) {
+		t.Errorf("inputs not done should be routed to dead-letter sink, got %+v", stats[0])
+	}
+	for _, dl := range letters {
+		if dl.Err != ErrPipelineAborted {
+			t.Errorf("aborted inputs should fail with ErrPipelineAborted, got %v", dl.Err)
+		}
+	}
+	if err := p.Close(context.Background()); err != nil {
+		t.Error("closing aborted pipeline again should return at once:", err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	fmt.Println(t.Name())
+	if _, err := New(nil); err != ErrNoStages {
+		t.Error("pipeline without stages should not be created")
+	}
+	if _, err := New([]Stage{{Name: "nil"}}); err != ErrNilFunc {
+		t.Error("pipeline with nil func should not be created")
+	}
+
+	p, err := New([]Stage{{Func: func(arg interface{}) (interface{}, error) { return arg, nil }, Options: []pond.Option{pond.WithMiddleware(pond.RecoveryMiddleware())}}})
+	if err != nil {
+		t.Error("pipeline should be created:", err)
+		return
+	}
+	_ = p.Close(context.Background())
+	if _, ok := <-p.Output(); ok {
+		t.Error("output should be closed after pipeline closed")
+	}
+}
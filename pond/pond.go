@@ -1,21 +1,50 @@
 package pond
 
+import "time"
+
 // pond package level default pool constructor
 // NewPool return a new basicPool instance
 func NewPool(cap ...int) Pool {
-	return newBasicPool(nil, cap...)
+	return newBasicPool(newOptions(capacityOptions(cap)...), defaultTaskQueueCapacity)
+}
+
+// NewPoolWithOptions return a new basicPool instance configured by opts.
+func NewPoolWithOptions(opts ...Option) Pool {
+	return newBasicPool(newOptions(opts...), defaultTaskQueueCapacity)
 }
 
-func NewFixedSizePool(cap, maxTasks int) Pool {
-	return newFixedSizePool(cap, maxTasks, nil)
+func NewFixedSizePool(cap, maxTasks int, opts ...Option) Pool {
+	return newFixedSizePool(cap, maxTasks, newOptions(opts...))
 }
 
 func NewFixedFuncPool(fixedFunc FixedFunc, cap ...int) *FixedFuncPool {
-	return newFixedFuncPool(fixedFunc, nil, cap...)
+	return newFixedFuncPool(fixedFunc, newOptions(capacityOptions(cap)...))
+}
+
+// NewFixedFuncPoolWithOptions return a new FixedFuncPool instance
+// configured by opts.
+func NewFixedFuncPoolWithOptions(fixedFunc FixedFunc, opts ...Option) *FixedFuncPool {
+	return newFixedFuncPool(fixedFunc, newOptions(opts...))
+}
+
+// NewBatchFuncPool return a new BatchFuncPool instance which call f with
+// batches of at most maxSize arguments, a batch is flushed after maxWait
+// even if not full.
+func NewBatchFuncPool(f BatchFunc, maxSize int, maxWait time.Duration, opts ...Option) *BatchFuncPool {
+	return newBatchFuncPool(f, maxSize, maxWait, newOptions(opts...))
 }
 
 // NewCustomizedWorkerPool create a pool with user-customized worker
 // implementation, as user implement all asked interface.
 func NewCustomizedWorkerPool(wc WorkerCtor, cap ...int) Pool {
-	return newBasicPool(wc, cap...)
+	return newBasicPool(newOptions(append(capacityOptions(cap), WithWorkerCtor(wc))...), defaultTaskQueueCapacity)
+}
+
+// capacityOptions convert the optional capacity argument of legacy
+// constructors to options.
+func capacityOptions(cap []int) []Option {
+	if len(cap) == 0 {
+		return nil
+	}
+	return []Option{WithCapacity(cap[0])}
 }
@@ -0,0 +1,109 @@
+package pond
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func batchPow(args []interface{}) ([]interface{}, error) {
+	results := make([]interface{}, len(args))
+	for i, arg := range args {
+		n := arg.(int)
+		if n < 0 {
+			results[i] = errors.New("negative")
+			continue
+		}
+		results[i] = n * n
+	}
+	return results, nil
+}
+
+func TestBatchFuncPoolMaxSize(t *testing.T) {
+	fmt.Println(t.Name())
+	var calls int32
+	pool := NewBatchFuncPool(func(args []interface{}) ([]interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		return batchPow(args)
+	}, 3, time.Hour, WithCapacity(1))
+	var futures []Future
+	for i := 0; i < 3; i++ {
+		future, _ := pool.Submit(i + 1)
+		futures = append(futures, future)
+	}
+	for i, future := range futures {
+		if val, _ := future.Value(); val != (i+1)*(i+1) {
+			t.Errorf("result of %d should be fanned back, got %v", i+1, val)
+		}
+	}
+	if atomic.LoadInt32(&calls) != 1 {
+		t.Error("full batch should be processed by one call")
+	}
+	pool.Close()
+}
+
+func TestBatchFuncPoolMaxWait(t *testing.T) {
+	fmt.Println(t.Name())
+	pool := NewBatchFuncPool(batchPow, 100, 10*time.Millisecond, WithCapacity(1))
+	ok, _ := pool.Submit(2)
+	bad, _ := pool.Submit(-1)
+	if val, _ := ok.Value(); val != 4 {
+		t.Error("batch should be flushed after max wait")
+	}
+	if _, err := bad.Value(); err == nil {
+		t.Error("error element should be reported to its argument")
+	}
+	pool.Close()
+}
+
+func TestBatchFuncPoolClose(t *testing.T) {
+	fmt.Println(t.Name())
+	pool := NewBatchFuncPool(batchPow, 100, time.Hour, WithCapacity(1))
+	future, _ := pool.Submit(1)
+	pool.Close()
+	if _, err := future.Value(); err != ErrPoolClosed {
+		t.Error("pending argument should fail when pool closed")
+	}
+	if _, err := pool.Submit(1); err != ErrPoolClosed {
+		t.Error("pool has closed, no more task submitted and should return ErrPoolClosed")
+	}
+}
+
+func TestBatchFuncPoolCloseQueued(t *testing.T) {
+	fmt.Println(t.Name())
+	block := make(chan struct{})
+	pool := NewBatchFuncPool(func(args []interface{}) ([]interface{}, error) {
+		<-block
+		return batchPow(args)
+	}, 1, time.Hour, WithCapacity(1))
+	running, _ := pool.Submit(1)
+	time.Sleep(10 * time.Millisecond)
+	// the second batch waits in task queue.
+	queued, _ := pool.Submit(2)
+	time.Sleep(10 * time.Millisecond)
+	pool.Close()
+	close(block)
+	if val, _ := running.Value(); val != 1 {
+		t.Error("running batch should be done after pool closed")
+	}
+	if _, err := queued.Value(); err != ErrPoolClosed {
+		t.Error("batch left in task queue should fail when pool closed")
+	}
+}
+
+func TestBatchFuncPoolPanic(t *testing.T) {
+	fmt.Println(t.Name())
+	pool := NewBatchFuncPool(func(args []interface{}) ([]interface{}, error) {
+		panic("batch panic")
+	}, 2, time.Hour, WithCapacity(1), WithMiddleware(RecoveryMiddleware()))
+	first, _ := pool.Submit(1)
+	second, _ := pool.Submit(2)
+	for _, future := range []Future{first, second} {
+		if _, err := future.Value(); err != ErrTaskPanicked {
+			t.Error("items of panicking batch should fail with ErrTaskPanicked")
+		}
+	}
+	pool.Close()
+}
@@ -2,7 +2,9 @@ package pond
 
 import (
 	"fmt"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func fooPow(num interface{}) (i interface{}, err error) {
@@ -12,7 +14,7 @@ func fooPow(num interface{}) (i interface{}, err error) {
 
 func TestFixedFuncPoolSubmit(t *testing.T) {
 	fmt.Println(t.Name())
-	pool := newFixedFuncPool(fooPow, nil)
+	pool := newFixedFuncPool(fooPow, newOptions())
 	future, _ := pool.Submit(2)
 	val, _ := future.Value()
 	if val = val.(int); val != 4 {
@@ -23,7 +25,7 @@ func TestFixedFuncPoolSubmit(t *testing.T) {
 
 func TestFixedFuncPoolSetNewFixedFunc(t *testing.T) {
 	fmt.Println(t.Name())
-	pool := newFixedFuncPool(fooPow, nil)
+	pool := newFixedFuncPool(fooPow, newOptions())
 	future, _ := pool.Submit(2)
 	val, _ := future.Value()
 	if val = val.(int); val != 4 {
@@ -41,3 +43,140 @@ func TestFixedFuncPoolSetNewFixedFunc(t *testing.T) {
 	}
 	pool.Close()
 }
+
+func TestFixedFuncPoolHotSwap(t *testing.T) {
+	fmt.Println(t.Name())
+	release := make(chan struct{})
+	pool := newFixedFuncPool(func(num interface{}) (interface{}, error) {
+		<-release
+		return fooPow(num)
+	}, newOptions(WithCapacity(2)))
+	old, _ := pool.Submit(2)
+
+	swapped := make(chan uint64)
+	go func() {
+		swapped <- pool.SetNewFixedFunc(func(num interface{}) (interface{}, error) {
+			return num.(int) * 10, nil
+		})
+	}()
+	// new submissions are served by new function while old task running.
+	for pool.Version() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	future, _ := pool.Submit(2)
+	if val, _ := future.Value(); val != 20 || future.(VersionedFuture).Version() != 2 {
+		t.Errorf("task should run on new function, got %v of version %d", val, future.(VersionedFuture).Version())
+	}
+	select {
+	case <-swapped:
+		t.Error("swapping should wait for old tasks done")
+	default:
+	}
+
+	close(release)
+	if val, _ := old.Value(); val != 4 || old.(VersionedFuture).Version() != 1 {
+		t.Errorf("old task should finish on old function, got %v of version %d", val, old.(VersionedFuture).Version())
+	}
+	if version := <-swapped; version != 2 {
+		t.Errorf("new version should be 2, got %d", version)
+	}
+	pool.Close()
+}
+
+func TestFixedFuncPoolHotSwapClose(t *testing.T) {
+	fmt.Println(t.Name())
+	release := make(chan struct{})
+	pool := NewFixedFuncPoolWithOptions(func(num interface{}) (interface{}, error) {
+		<-release
+		return fooPow(num)
+	}, WithCapacity(1))
+	_, _ = pool.Submit(2)
+	time.Sleep(10 * time.Millisecond)
+	// the second task waits in task queue and is dropped by Close.
+	_, _ = pool.Submit(3)
+
+	swapped := make(chan uint64)
+	go func() {
+		swapped <- pool.SetNewFixedFunc(fooPow)
+	}()
+	pool.Close()
+	close(release)
+	select {
+	case <-swapped:
+	case <-time.After(time.Second):
+		t.Error("swapping should not wait for tasks dropped by Close")
+	}
+}
+
+func TestFixedFuncPoolDedupKey(t *testing.T) {
+	fmt.Println(t.Name())
+	var calls int32
+	release := make(chan struct{})
+	pool := NewFixedFuncPoolWithOptions(func(arg interface{}) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return fooPow(arg)
+	}, WithCapacity(2), WithDedupKey(func(arg interface{}) string {
+		return fmt.Sprint(arg)
+	}))
+
+	f1, _ := pool.Submit(3)
+	f2, _ := pool.Submit(3)
+	f3, _ := pool.Submit(4)
+	close(release)
+	v1, _ := f1.Value()
+	v2, _ := f2.Value()
+	v3, _ := f3.Value()
+	if v1 != 9 || v2 != 9 || v3 != 16 {
+		t.Errorf("coalesced calls should share result, got %v %v %v", v1, v2, v3)
+	}
+	if atomic.LoadInt32(&calls) != 2 || pool.Stats().Coalesced != 1 {
+		t.Errorf("identical call should be coalesced, got %d calls", calls)
+	}
+
+	// key is released after call done.
+	f4, _ := pool.Submit(3)
+	_, _ = f4.Value()
+	if atomic.LoadInt32(&calls) != 3 {
+		t.Error("call after the in-flight one done should not be coalesced")
+	}
+	if stats := pool.Stats(); stats.Submitted != 3 || stats.Completed != 3 {
+		t.Errorf("stats should count submitted and completed calls, got %+v", stats)
+	}
+	pool.Close()
+}
+
+func TestFixedFuncPoolDedupTimeout(t *testing.T) {
+	fmt.Println(t.Name())
+	pool := NewFixedFuncPoolWithOptions(fooPow, WithCapacity(1), WithDedupKey(func(arg interface{}) string {
+		return fmt.Sprint(arg)
+	}))
+	// the call of key 3 is being submitted and never gets ready.
+	pool.inflight["3"] = &dedupCall{ready: make(chan struct{})}
+	if _, err := pool.SubmitWithTimeout(3, 10*time.Millisecond); err != ErrTaskTimeout {
+		t.Error("coalesced submission should respect its own timeout")
+	}
+	pool.Close()
+}
+
+func TestFixedFuncPoolDedupPanic(t *testing.T) {
+	fmt.Println(t.Name())
+	var calls int32
+	pool := NewFixedFuncPoolWithOptions(func(arg interface{}) (interface{}, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			panic("first call panics")
+		}
+		return fooPow(arg)
+	}, WithCapacity(1), WithMiddleware(RecoveryMiddleware()), WithDedupKey(func(arg interface{}) string {
+		return fmt.Sprint(arg)
+	}))
+	future, _ := pool.Submit(3)
+	if _, err := future.Value(); err == nil {
+		t.Error("panicking call should fail")
+	}
+	future, _ = pool.Submit(3)
+	if val, _ := future.Value(); val != 9 {
+		t.Error("key of panicking call should be released")
+	}
+	pool.Close()
+}
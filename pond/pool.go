@@ -1,20 +1,17 @@
 package pond
 
 import (
+	"context"
+	"fmt"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-// Pool interface defines the critical methods a pool must implement,
-// it also represents the main methods exposed to users.
-type Pool interface {
-	// Submit is the main entry for submitting new tasks.
-	Submit(task Task) (Future, error)
-
-	// SubmitWithTimeout submit a new task and set expiration.
-	SubmitWithTimeout(task Task, timeout time.Duration) (Future, error)
-
+// ManagedPool defines the management methods shared by all pools, no
+// matter what kind of tasks they accept.
+type ManagedPool interface {
 	// SetCapacity dynamically reset the capacity(number of workers) of pool.
 	SetCapacity(newCap int)
 
@@ -23,7 +20,7 @@ type Pool interface {
 
 	// Pause will block the whole pool, util Resume is invoked.
 	// Pool should wait for all under running tasks to be done, and
-	// clear all idle workers.
+	// clear all idle workers. It is a no-op if pool is paused or closed.
 	Pause()
 
 	// Resume restart the paused pool, if pool is in running state,
@@ -35,40 +32,265 @@ type Pool interface {
 	Close()
 }
 
+// PoolState is the lifecycle state of pool.
+type PoolState int32
+
+const (
+	// PoolRunning accept and run tasks.
+	PoolRunning PoolState = iota
+	// PoolPaused reject new tasks until resumed.
+	PoolPaused
+	// PoolClosed reject all tasks forever.
+	PoolClosed
+)
+
+func (s PoolState) String() string {
+	switch s {
+	case PoolRunning:
+		return "running"
+	case PoolPaused:
+		return "paused"
+	case PoolClosed:
+		return "closed"
+	}
+	return "unknown"
+}
+
+// Pool interface defines the critical methods a pool must implement,
+// it also represents the main methods exposed to users.
+type Pool interface {
+	ManagedPool
+
+	// Submit is the main entry for submitting new tasks.
+	Submit(task Task) (Future, error)
+
+	// SubmitWithTimeout submit a new task and set expiration.
+	SubmitWithTimeout(task Task, timeout time.Duration) (Future, error)
+}
+
+// Pool implementations may support optional behaviors by implementing
+// the interfaces below, pools returned by constructors of this package
+// implement all of them, e.g.
+//
+//	future, err := pool.(pond.StatefulSubmitter).SubmitWithState(task)
+//
+// so that Pool itself keeps stable for its implementers.
+var (
+	_ StatefulSubmitter = (*basicPool)(nil)
+	_ CostSubmitter     = (*basicPool)(nil)
+	_ StatsReporter     = (*basicPool)(nil)
+	_ TaskInspector     = (*basicPool)(nil)
+	_ MetadataSubmitter = (*basicPool)(nil)
+	_ TaskTracker       = (*basicPool)(nil)
+	_ StreamSubmitter   = (*basicPool)(nil)
+	_ TenantScheduler   = (*basicPool)(nil)
+	_ SubPooler         = (*basicPool)(nil)
+	_ TaskSupervisor    = (*basicPool)(nil)
+	_ DurableSubmitter  = (*basicPool)(nil)
+)
+
+// StatefulSubmitter is implemented by pools accepting StatefulTask.
+type StatefulSubmitter interface {
+	// SubmitWithState submit a new task which receive the state owned
+	// by the worker executing it, see WithWorkerState.
+	SubmitWithState(task StatefulTask) (Future, error)
+}
+
+// CostSubmitter is implemented by pools accepting tasks of different
+// costs of rate limit.
+type CostSubmitter interface {
+	// SubmitWithCost submit a new task which consume tokens of rate limit,
+	// see WithRateLimit. Cost is ignored if pool is not rate limited, but
+	// it must be at least one token.
+	SubmitWithCost(task Task, tokens int) (Future, error)
+}
+
 type basicPool struct {
 	capacity      int
 	workers       []Worker
-	taskQ         chan *taskWrapper
+	workerCtor    WorkerCtor
+	middlewares   []Middleware
+	hook          TaskHook
+	errorHandler  func(error)
+	lockOSThread  bool
+	cpus          []int
+	taskQ         chan *TaskEnvelope
 	pause         chan struct{}
 	close         chan struct{}
 	mu            sync.RWMutex
 	purgeDuration time.Duration
 	purgeTicker   *time.Ticker
+
+	// senders count goroutines sending into queues of pool, taskQ is
+	// closed after all of them quit.
+	senders sync.WaitGroup
+
+	// supervisors count tasks supervised on reserved workers, Close
+	// waits for them.
+	supervisors sync.WaitGroup
+
+	// tasks wait in rateQ for tokens of bucket before pushed into taskQ,
+	// they are nil if pool is not rate limited.
+	rateQ  chan *TaskEnvelope
+	bucket *tokenBucket
+
+	// tasks wait in limitQ for permits of limiter before pushed into
+	// taskQ, they are nil if pool is not adaptively limited.
+	limitQ  chan *TaskEnvelope
+	limiter *adaptiveLimiter
+
+	stats poolStats
+
+	// tasks track submitted tasks by IDs, it is nil if not enabled.
+	tasks *taskRegistry
+
+	// durable log tasks submitted by SubmitDurable, it is nil if not
+	// enabled.
+	durable *durableQueue
+
+	// fair schedule tasks submitted by SubmitForTenant, it is nil
+	// until first used.
+	fair *fairScheduler
+
+	// sub-pool has no workers and forwards tasks to parent with at most
+	// subLimit ones running, parent is nil for root pools.
+	name     string
+	parent   *basicPool
+	children map[string]*basicPool
+	subLimit *fixedLimit
+	permits  *adaptiveLimiter
 }
 
-func newBasicPool(wc WorkerCtor, cap ...int) *basicPool {
-	cores := runtime.NumCPU()
+func newBasicPool(o *options, queueSize int) *basicPool {
 	bp := &basicPool{
-		capacity:      append(cap, defaultPoolCapacityFactor*cores)[0],
-		taskQ:         make(chan *taskWrapper, defaultTaskQueueCapacity),
+		capacity:      o.capacity,
+		workerCtor:    o.workerCtor,
+		middlewares:   o.middlewares,
+		hook:          o.hook,
+		errorHandler:  o.errorHandler,
+		lockOSThread:  o.lockOSThread,
+		cpus:          o.cpus,
+		taskQ:         make(chan *TaskEnvelope, queueSize),
 		pause:         make(chan struct{}, 1), // make pause buffered
 		close:         make(chan struct{}),
 		purgeDuration: defaultPurgeWorkersDuration,
 		purgeTicker:   time.NewTicker(defaultPurgeWorkersDuration),
 	}
-	if wc == nil {
-		for i := 0; i < bp.capacity; i++ {
-			bp.workers = append(bp.workers, newPondWorker(bp.taskQ))
-		}
-	} else {
-		for i := 0; i < bp.capacity; i++ {
-			bp.workers = append(bp.workers, wc(bp.taskQ))
-		}
+	if bp.workerCtor == nil {
+		bp.workerCtor = pondWorkerCtor(o)
+	}
+	for i := 0; i < bp.capacity; i++ {
+		bp.spawnWorker()
+	}
+	if o.rate > 0 {
+		bp.rateQ = make(chan *TaskEnvelope, queueSize)
+		bp.bucket = newTokenBucket(o.rate, o.burst, o.clock)
+		go bp.dispatchRateLimited()
+	}
+	if o.limitAlgo != nil {
+		bp.limitQ = make(chan *TaskEnvelope, queueSize)
+		bp.limiter = newAdaptiveLimiter(o.limitAlgo, o.clock, bp.close)
+		go bp.dispatchLimited()
+	}
+	if o.durable != nil {
+		bp.durable = newDurableQueue(*o.durable)
+	}
+	if o.taskRetention > 0 {
+		bp.tasks = newTaskRegistry(o.taskRetention)
+	}
+	bp.stats.tasks.enabled = o.runningTasks || o.watchdog != nil
+	if o.watchdog != nil {
+		bp.stats.tasks.retire = bp.retireWorker
+		go bp.watch(o.watchdog)
 	}
 	go bp.purgeWorkers()
 	return bp
 }
 
+// spawnWorker construct and initialize a new worker, launch it and
+// add it to workers, it is discarded and the error is reported if
+// initialization failed. Caller should hold the write lock except in
+// constructor.
+func (bp *basicPool) spawnWorker() {
+	w := bp.workerCtor(bp.taskQ)
+	initErr := make(chan error, 1)
+	go bp.runWorker(w, initErr)
+	if err := <-initErr; err != nil {
+		bp.reportError(fmt.Errorf("%w: %v", ErrWorkerInit, err))
+		return
+	}
+	bp.workers = append(bp.workers, w)
+}
+
+// runWorker initialize and run worker in current goroutine, which is
+// locked to its own OS thread ahead of Init if WithLockOSThread set. The
+// result of Init is sent to initErr.
+func (bp *basicPool) runWorker(w Worker, initErr chan<- error) {
+	if bp.lockOSThread {
+		defer bp.lockThread()()
+	}
+	if err := w.Init(); err != nil {
+		initErr <- err
+		return
+	}
+	initErr <- nil
+	w.Run()
+}
+
+// lockThread lock current goroutine to its OS thread and pin the thread
+// to cpus, return a function to undo them when worker stopped. Pinning
+// failure is reported and the worker runs unpinned.
+func (bp *basicPool) lockThread() (unlock func()) {
+	runtime.LockOSThread()
+	restore := func() error { return nil }
+	if len(bp.cpus) > 0 {
+		r, err := pinThread(bp.cpus)
+		if err != nil {
+			bp.reportError(fmt.Errorf("worker: pin thread to cpus %v: %w", bp.cpus, err))
+		} else {
+			restore = r
+		}
+	}
+	return func() {
+		// a thread with unknown affinity must not go back to scheduler,
+		// keep it locked and runtime terminates it as worker exits.
+		if restore() == nil {
+			runtime.UnlockOSThread()
+		}
+	}
+}
+
+// ensureWorker spawn a worker if pool has none, which happens when all
+// workers failed to initialize. It retries on every submission so that
+// queued tasks are consumed once initialization recovers.
+func (bp *basicPool) ensureWorker() {
+	bp.mu.RLock()
+	n := len(bp.workers)
+	bp.mu.RUnlock()
+	if n > 0 {
+		return
+	}
+
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	select {
+	case <-bp.close:
+		return
+	default:
+	}
+	if len(bp.workers) == 0 && bp.capacity > 0 {
+		bp.spawnWorker()
+	}
+}
+
+// reportError pass error raised in background to error handler of pool,
+// see WithErrorHandler.
+func (bp *basicPool) reportError(err error) {
+	if bp.errorHandler != nil {
+		bp.errorHandler(err)
+	}
+}
+
 // purgeWorkers purge idle workers periodically and recycle resource.
 func (bp *basicPool) purgeWorkers() {
 	for {
@@ -76,34 +298,50 @@ func (bp *basicPool) purgeWorkers() {
 		case <-bp.close:
 			return
 		case <-bp.purgeTicker.C:
+			// paused pool keeps its workers untouched until resumed.
+			if len(bp.pause) > 0 {
+				continue
+			}
 			bp.mu.Lock()
-			beg, end := 0, len(bp.workers)-1
-			for beg < end {
-				if bp.workers[beg].Idle() {
-					// swap idle worker to the back
-					bp.workers[beg], bp.workers[end] = bp.workers[end], bp.workers[beg]
-					bp.workers[end].Close()
-					bp.workers[end] = nil
-					end--
-				}
-				if !bp.workers[beg].Idle() {
-					beg++
+			alive := bp.workers[:0]
+			for i, worker := range bp.workers {
+				// keep at least one worker consuming the task queue.
+				if worker.Idle() && len(alive)+len(bp.workers)-i > 1 {
+					worker.Close()
+					continue
 				}
+				alive = append(alive, worker)
 			}
-			// handle edge case
-			if bp.workers[end].Idle() {
-				bp.workers = bp.workers[:end]
-			} else {
-				bp.workers = bp.workers[:end+1]
+			for i := len(alive); i < len(bp.workers); i++ {
+				bp.workers[i] = nil
 			}
+			bp.workers = alive
 			bp.mu.Unlock()
-		default:
-			bp.tryPause()
 		}
 	}
 }
 
 func (bp *basicPool) Submit(task Task) (Future, error) {
+	return bp.submit(rscPool.GetTask(statelessTask(task), nil), -1)
+}
+
+func (bp *basicPool) SubmitWithTimeout(task Task, timeout time.Duration) (Future, error) {
+	return bp.submit(rscPool.GetTask(statelessTask(task), nil), timeout)
+}
+
+func (bp *basicPool) SubmitWithState(task StatefulTask) (Future, error) {
+	return bp.submit(rscPool.GetTask(task, nil), -1)
+}
+
+func (bp *basicPool) SubmitWithCost(task Task, tokens int) (Future, error) {
+	tw := rscPool.GetTask(statelessTask(task), nil)
+	tw.cost = tokens
+	return bp.submit(tw, -1)
+}
+
+// submit wrap task with middlewares and push it into task queue, a
+// negative timeout means blocking until task queue is available.
+func (bp *basicPool) submit(tw *TaskEnvelope, timeout time.Duration) (Future, error) {
 	// not all callers hold the returned Future, so that there may no
 	// receiver side which may cause block when worker send return values.
 	rc := make(chan *taskResult, 1)
@@ -116,47 +354,169 @@ func (bp *basicPool) Submit(task Task) (Future, error) {
 	}
 
 	// check paused
-	if len(bp.pause) > 0 {
+	if bp.paused() {
 		return nil, ErrPoolPaused
 	}
 
-	bp.taskQ <- rscPool.GetTask(task, rc)
+	if tw.cost < 1 {
+		return nil, ErrTaskCost
+	}
+	if bp.bucket != nil && float64(tw.cost) > bp.bucket.burst {
+		return nil, ErrTaskCost
+	}
+	queue := bp.queue()
+
+	// envelope is ready to be reported before registered, so that it can
+	// be cancelled right after.
+	tw.resChan = rc
+	if bp.tasks != nil {
+		if tw.meta == nil {
+			tw.meta = &TaskOptions{}
+		}
+		if tw.meta.ID == "" {
+			tw.meta.ID = nextTaskID()
+		}
+		if err := bp.tasks.add(tw); err != nil {
+			return nil, err
+		}
+	}
+
+	tw.t = bp.wrap(tw)
+	future := newPondFuture(rc)
+	if tw.meta != nil {
+		future.id = tw.meta.ID
+	}
+	if err := bp.send(context.Background(), tw, queue, timeout); err != nil {
+		bp.untrack(tw)
+		return nil, err
+	}
+
+	atomic.AddUint64(&bp.stats.submitted, 1)
 	bp.scale()
-	return newPondFuture(rc), nil
+
+	return future, nil
 }
 
-func (bp *basicPool) SubmitWithTimeout(task Task, timeout time.Duration) (Future, error) {
-	// not all callers hold the returned Future, so that there may no
-	// receiver side which may cause block when worker send return values.
-	rc := make(chan *taskResult, 1)
+// queue return the queue accepting tasks, tasks pass through rateQ and
+// limitQ in order if enabled before reaching taskQ.
+func (bp *basicPool) queue() chan *TaskEnvelope {
+	if bp.rateQ != nil {
+		return bp.rateQ
+	}
+	return bp.limitedQueue()
+}
 
-	// check closed
-	select {
-	case <-bp.close:
-		return nil, ErrPoolClosed
-	default:
+// limitedQueue return the queue of tasks passed rate limit.
+func (bp *basicPool) limitedQueue() chan *TaskEnvelope {
+	if bp.limitQ != nil {
+		return bp.limitQ
 	}
+	return bp.taskQ
+}
 
-	// check paused
-	if len(bp.pause) > 0 {
-		return nil, ErrPoolPaused
+// untrack unregister task failed to be submitted from task registry.
+func (bp *basicPool) untrack(te *TaskEnvelope) {
+	if bp.tasks != nil {
+		bp.tasks.remove(te.meta.ID)
+	}
+}
+
+// dispatch push task accepted by background goroutines into task queue,
+// unlike submit, it ignores pause because the task has been accepted
+// before, and it is not registered in task registry. Return false if pool
+// closed.
+func (bp *basicPool) dispatch(te *TaskEnvelope) bool {
+	return bp.dispatchContext(context.Background(), te) == nil
+}
+
+// dispatchContext is like dispatch, but it gives up once ctx done and
+// returns ctx.Err(), ErrPoolClosed returned if pool closed.
+func (bp *basicPool) dispatchContext(ctx context.Context, te *TaskEnvelope) error {
+	if te.resChan == nil {
+		te.resChan = make(chan *taskResult, 1)
+	}
+	te.t = bp.wrap(te)
+	if err := bp.send(ctx, te, bp.queue(), -1); err != nil {
+		return err
+	}
+	atomic.AddUint64(&bp.stats.submitted, 1)
+	return nil
+}
+
+// forward push task into queue for goroutines other than submitter,
+// return false if pool closed.
+func (bp *basicPool) forward(te *TaskEnvelope, queue chan *TaskEnvelope) bool {
+	return bp.send(context.Background(), te, queue, -1) == nil
+}
+
+// send push task into queue, a negative timeout means blocking until
+// queue is available or ctx done. Sending is done without locks held, so that a full
+// queue never blocks SetCapacity or purgeWorkers.
+func (bp *basicPool) send(ctx context.Context, te *TaskEnvelope, queue chan *TaskEnvelope, timeout time.Duration) error {
+	if !bp.enter() {
+		return ErrPoolClosed
 	}
+	defer bp.senders.Done()
 
+	var expired <-chan time.Time
+	if timeout >= 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
 	select {
-	case <-time.After(timeout):
-		return nil, ErrTaskTimeout
-	case bp.taskQ <- rscPool.GetTask(task, rc):
+	case <-bp.close:
+		return ErrPoolClosed
+	case <-expired:
+		return ErrTaskTimeout
+	case <-ctx.Done():
+		return ctx.Err()
+	case queue <- te:
+		return nil
 	}
+}
 
-	bp.scale()
+// enter register a sender of queues, return false if pool closed.
+func (bp *basicPool) enter() bool {
+	// taskQ is closed under write lock after pool closed.
+	bp.mu.RLock()
+	defer bp.mu.RUnlock()
+	select {
+	case <-bp.close:
+		return false
+	default:
+	}
+	bp.senders.Add(1)
+	return true
+}
 
-	return newPondFuture(rc), nil
+// dropQueue report ErrPoolClosed to tasks left in queue until it is
+// empty.
+func dropQueue(queue chan *TaskEnvelope) {
+	for {
+		select {
+		case te, ok := <-queue:
+			if !ok {
+				return
+			}
+			te.drop(ErrPoolClosed)
+		default:
+			return
+		}
+	}
 }
 
 func (bp *basicPool) SetCapacity(newCap int) {
 	bp.mu.Lock()
 	defer bp.mu.Unlock()
 
+	if bp.parent != nil {
+		bp.capacity = newCap
+		bp.subLimit.set(newCap)
+		bp.permits.notify()
+		return
+	}
+
 	curCap := len(bp.workers)
 	bp.capacity = newCap
 	if curCap == newCap {
@@ -165,7 +525,7 @@ func (bp *basicPool) SetCapacity(newCap int) {
 
 	if curCap < newCap {
 		for i := curCap; i < newCap; i++ {
-			bp.workers = append(bp.workers, newPondWorker(bp.taskQ))
+			bp.spawnWorker()
 		}
 		return
 	}
@@ -180,16 +540,17 @@ func (bp *basicPool) SetCapacity(newCap int) {
 }
 
 func (bp *basicPool) Pause() {
-	bp.pause <- struct{}{}
-}
-
-// tryPause judge if pool is in paused state, if so, stop
-// current action and wait for resume.
-func (bp *basicPool) tryPause() {
-	if _, open := <-bp.close; open && len(bp.pause) > 0 {
-		// try send signal and it will block because buffer size
-		// of pause channel is 1
-		bp.pause <- struct{}{}
+	// pause is closed by Close under write lock.
+	bp.mu.RLock()
+	defer bp.mu.RUnlock()
+	select {
+	case <-bp.close:
+		return
+	default:
+	}
+	select {
+	case bp.pause <- struct{}{}:
+	default:
 	}
 }
 
@@ -201,10 +562,27 @@ func (bp *basicPool) Resume() {
 }
 
 func (bp *basicPool) Close() {
-	bp.mu.Lock()
-	defer bp.mu.Unlock()
+	if bp.parent != nil {
+		bp.closeSubPool()
+		return
+	}
+	for _, sub := range bp.subPools() {
+		sub.Close()
+	}
 
+	// signal closing ahead of locking, so that senders blocked on full
+	// queues can quit.
 	close(bp.close)
+
+	// supervised tasks are signalled to stop by closing, and counted
+	// under read lock after checking closing, so passing the lock once
+	// makes sure all of them counted. They are waited without lock, so
+	// that they can still inspect pool while stopping.
+	bp.mu.Lock()
+	bp.mu.Unlock()
+	bp.supervisors.Wait()
+
+	bp.mu.Lock()
 	close(bp.pause)
 
 	// clear workers
@@ -213,8 +591,39 @@ func (bp *basicPool) Close() {
 	}
 	bp.workers = nil
 
+	bp.senders.Wait()
 	close(bp.taskQ)
 	bp.purgeTicker.Stop()
+	// tasks left in queues are never executed, report them so that their
+	// Futures are resolved.
+	dropQueue(bp.taskQ)
+	dropQueue(bp.rateQ)
+	dropQueue(bp.limitQ)
+	bp.mu.Unlock()
+
+	// durable tasks running are acknowledged ahead of closing the log,
+	// waiting without lock so that they never block on pool.
+	if bp.durable != nil {
+		bp.durable.close()
+	}
+}
+
+// State return current state of pool.
+func (bp *basicPool) State() PoolState {
+	select {
+	case <-bp.close:
+		return PoolClosed
+	default:
+	}
+	if len(bp.pause) > 0 {
+		return PoolPaused
+	}
+	return PoolRunning
+}
+
+// paused report whether pool or its parent paused.
+func (bp *basicPool) paused() bool {
+	return len(bp.pause) > 0 || bp.parent != nil && bp.parent.paused()
 }
 
 // Capacity return current capacity of pool.
@@ -224,8 +633,16 @@ func (bp *basicPool) Capacity() int {
 	return bp.capacity
 }
 
-// Workers return current number of under working workers.
+// Workers return current number of under working workers, for sub-pool,
+// it is the number of parent's workers available to it.
 func (bp *basicPool) Workers() int {
+	if bp.parent != nil {
+		workers := bp.parent.Workers()
+		if limit := bp.subLimit.Limit(); limit < workers {
+			workers = limit
+		}
+		return workers
+	}
 	bp.mu.RLock()
 	defer bp.mu.RUnlock()
 	return len(bp.workers)
@@ -233,18 +650,24 @@ func (bp *basicPool) Workers() int {
 
 // SetPurgeDuration set duration of pool recycling its idle workers.
 func (bp *basicPool) SetPurgeDuration(dur time.Duration) {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
 	if dur != bp.purgeDuration {
-		bp.mu.Lock()
 		bp.purgeDuration = dur
-		bp.purgeTicker = time.NewTicker(dur)
-		bp.mu.Unlock()
+		// reset in place, purgeWorkers keeps receiving from the ticker.
+		bp.purgeTicker.Reset(dur)
 	}
 }
 
 // scale expand number of workers when too many tasks accumulated.
 func (bp *basicPool) scale() {
+	// sub-pool never owns workers.
+	if bp.parent != nil {
+		return
+	}
 	if float32(cap(bp.taskQ))*autoScaleFactor < float32(len(bp.taskQ)) {
 		bp.SetCapacity(2 * bp.capacity)
 	}
+	bp.ensureWorker()
 	// purgeWorkers() response for shrinking.
 }
@@ -0,0 +1,242 @@
+package pond
+
+import (
+	"sync"
+	"time"
+)
+
+// BatchFunc process a batch of arguments in bulk and return results in
+// the same order, if an element of results is an error, it is reported
+// as the error of corresponding argument.
+type BatchFunc func(args []interface{}) ([]interface{}, error)
+
+// BatchFuncPool accept single arguments like FixedFuncPool, but group
+// them into batches by max size or max wait, and call the batch function
+// once per batch. Results are fanned back to Future of every argument.
+type BatchFuncPool struct {
+	pool    *basicPool
+	f       BatchFunc
+	maxSize int
+	maxWait time.Duration
+	argQ    chan *batchItem
+	done    chan struct{}
+
+	// senders count goroutines sending into argQ, argQ is drained after
+	// pool closed and all of them quit.
+	mu      sync.Mutex
+	closed  bool
+	senders sync.WaitGroup
+}
+
+type batchItem struct {
+	arg     interface{}
+	resChan chan *taskResult
+}
+
+func newBatchFuncPool(f BatchFunc, maxSize int, maxWait time.Duration, o *options) *BatchFuncPool {
+	if maxSize < 1 {
+		maxSize = 1
+	}
+	p := &BatchFuncPool{
+		pool:    newBasicPool(o, defaultTaskQueueCapacity),
+		f:       f,
+		maxSize: maxSize,
+		maxWait: maxWait,
+		argQ:    make(chan *batchItem, defaultTaskQueueCapacity),
+		done:    make(chan struct{}),
+	}
+	go p.collect()
+	return p
+}
+
+func (p *BatchFuncPool) Submit(arg interface{}) (Future, error) {
+	// not all callers hold the returned Future, so that there may no
+	// receiver side which may cause block when worker send return values.
+	rc := make(chan *taskResult, 1)
+
+	// check closed
+	if !p.enter() {
+		return nil, ErrPoolClosed
+	}
+	defer p.senders.Done()
+
+	// check paused
+	if len(p.pool.pause) > 0 {
+		return nil, ErrPoolPaused
+	}
+
+	select {
+	case <-p.pool.close:
+		return nil, ErrPoolClosed
+	case p.argQ <- &batchItem{arg: arg, resChan: rc}:
+	}
+	return newPondFuture(rc), nil
+}
+
+// enter register a sender of argQ, return false if pool closed.
+func (p *BatchFuncPool) enter() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return false
+	}
+	p.senders.Add(1)
+	return true
+}
+
+// collect group arguments into batches and dispatch them, a batch is
+// flushed once it is full or the oldest argument waited for maxWait.
+func (p *BatchFuncPool) collect() {
+	defer close(p.done)
+
+	// timeout is nil until the first argument of batch arrived.
+	var timer *time.Timer
+	var timeout <-chan time.Time
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+
+	batch := make([]*batchItem, 0, p.maxSize)
+	flush := func() bool {
+		items := batch
+		batch = make([]*batchItem, 0, p.maxSize)
+		te := rscPool.GetTask(p.batchTask(items), make(chan *taskResult, 1))
+		// batch left in task queue after pool closed is dropped.
+		te.onDrop(func() {
+			failBatch(items, ErrPoolClosed)
+		})
+		if !p.pool.waitResumed() || !p.pool.dispatch(te) {
+			te.drop(ErrPoolClosed)
+			return false
+		}
+		return true
+	}
+
+	for {
+		select {
+		case <-p.pool.close:
+			failBatch(batch, ErrPoolClosed)
+			return
+		case item := <-p.argQ:
+			batch = append(batch, item)
+			if len(batch) == 1 {
+				timer = time.NewTimer(p.maxWait)
+				timeout = timer.C
+			}
+			if len(batch) < p.maxSize {
+				continue
+			}
+			timer.Stop()
+			timeout = nil
+			if !flush() {
+				return
+			}
+		case <-timeout:
+			timeout = nil
+			if !flush() {
+				return
+			}
+		}
+	}
+}
+
+// batchTask return a task calling batch function with items, and report
+// results to every item.
+func (p *BatchFuncPool) batchTask(items []*batchItem) StatefulTask {
+	return func(interface{}) (interface{}, error) {
+		// items are failed if batch function panics, and the panic goes on.
+		reported := false
+		defer func() {
+			if !reported {
+				failBatch(items, ErrTaskPanicked)
+			}
+		}()
+
+		args := make([]interface{}, len(items))
+		for i, item := range items {
+			args[i] = item.arg
+		}
+		results, err := p.f(args)
+		reported = true
+		if err == nil && len(results) != len(args) {
+			err = ErrBatchResults
+		}
+		if err != nil {
+			failBatch(items, err)
+			return nil, err
+		}
+		for i, item := range items {
+			if e, ok := results[i].(error); ok {
+				item.resChan <- rscPool.GetTaskResult(nil, e)
+			} else {
+				item.resChan <- rscPool.GetTaskResult(results[i], nil)
+			}
+		}
+		return nil, nil
+	}
+}
+
+func failBatch(items []*batchItem, err error) {
+	for _, item := range items {
+		item.resChan <- rscPool.GetTaskResult(nil, err)
+	}
+}
+
+func (p *BatchFuncPool) SetCapacity(newCap int) {
+	p.pool.SetCapacity(newCap)
+}
+
+func (p *BatchFuncPool) Pause() {
+	p.pool.Pause()
+}
+
+func (p *BatchFuncPool) Resume() {
+	p.pool.Resume()
+}
+
+// Close close the pool, arguments not executed yet are failed with
+// ErrPoolClosed.
+func (p *BatchFuncPool) Close() {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+
+	p.pool.Close()
+	p.senders.Wait()
+	<-p.done
+	for {
+		select {
+		case item := <-p.argQ:
+			item.resChan <- rscPool.GetTaskResult(nil, ErrPoolClosed)
+		default:
+			return
+		}
+	}
+}
+
+func (p *BatchFuncPool) SetPurgeDuration(dur time.Duration) {
+	p.pool.SetPurgeDuration(dur)
+}
+
+func (p *BatchFuncPool) State() PoolState {
+	return p.pool.State()
+}
+
+func (p *BatchFuncPool) RunningTasks() []RunningTask {
+	return p.pool.RunningTasks()
+}
+
+func (p *BatchFuncPool) Capacity() int {
+	return p.pool.Capacity()
+}
+
+func (p *BatchFuncPool) Workers() int {
+	return p.pool.Workers()
+}
+
+// Stats return statistics of pool, every batch is counted as one task.
+func (p *BatchFuncPool) Stats() Stats {
+	return p.pool.Stats()
+}
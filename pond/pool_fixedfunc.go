@@ -1,8 +1,8 @@
 package pond
 
 import (
-	"context"
-	"runtime"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -10,125 +10,311 @@ import (
 // arguments, do execution and pass the result. See it as a
 // executor.
 type FixedFuncPool struct {
-	pool *basicPool
-	f    FixedFunc
+	pool    *basicPool
+	breaker *circuitBreaker
+
+	// fn is the current version of fixed function, tasks run on the
+	// version when they submitted.
+	fnMu sync.RWMutex
+	fn   *fixedFuncVersion
+
+	// inflight hold queued or running calls by dedup key.
+	dedup    func(arg interface{}) string
+	dedupMu  sync.Mutex
+	inflight map[string]*dedupCall
+
+	cache *resultCache
 }
 
-type FixedFunc func(interface{}) (interface{}, error)
+// dedupCall is a submitted call shared by submissions with the same key,
+// future and err are available after ready closed.
+type dedupCall struct {
+	ready  chan struct{}
+	future Future
+	err    error
+}
 
-func newFixedFuncPool(f FixedFunc, wc WorkerCtor, cap ...int) *FixedFuncPool {
-	cores := runtime.NumCPU()
-	bp := &basicPool{
-		capacity:      append(cap, defaultPoolCapacityFactor*cores)[0],
-		taskQ:         make(chan *taskWrapper, defaultTaskQueueCapacity),
-		pause:         make(chan struct{}, 1), // make pause buffered
-		close:         make(chan struct{}),
-		purgeDuration: defaultPurgeWorkersDuration,
-		purgeTicker:   time.NewTicker(defaultPurgeWorkersDuration),
-	}
-	if wc == nil {
-		for i := 0; i < bp.capacity; i++ {
-			bp.workers = append(bp.workers, newPondWorker(bp.taskQ))
-		}
-	} else {
-		for i := 0; i < bp.capacity; i++ {
-			bp.workers = append(bp.workers, wc(bp.taskQ))
-		}
+// wait block until call submitted, ErrTaskTimeout returned if it is not
+// submitted in timeout, a negative timeout means no timeout.
+func (call *dedupCall) wait(timeout time.Duration) error {
+	if timeout < 0 {
+		<-call.ready
+		return nil
 	}
-	go bp.purgeWorkers()
-	return &FixedFuncPool{
-		pool: bp,
-		f:    f,
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-call.ready:
+		return nil
+	case <-timer.C:
+		return ErrTaskTimeout
 	}
 }
 
-func (p *FixedFuncPool) Submit(arg interface{}) (Future, error) {
-	// not all callers hold the returned Future, so that there may no
-	// receiver side which may cause block when worker send return values.
-	rc := make(chan *taskResult, 1)
+type FixedFunc func(interface{}) (interface{}, error)
 
-	// check closed
-	select {
-	case <-p.pool.close:
-		return nil, ErrPoolClosed
-	default:
+// VersionedFuture is implemented by Futures returned by FixedFuncPool.
+type VersionedFuture interface {
+	Future
+
+	// Version return the version of fixed function which served the task,
+	// see SetNewFixedFunc.
+	Version() uint64
+}
+
+// fixedFuncVersion is a version of fixed function, it counts the tasks
+// submitted on it and not done yet, drained is closed when it is retired
+// and all these tasks done.
+type fixedFuncVersion struct {
+	f       FixedFunc
+	version uint64
+
+	mu      sync.Mutex
+	pending int
+	retired bool
+	drained chan struct{}
+}
+
+func newFixedFuncVersion(f FixedFunc, version uint64) *fixedFuncVersion {
+	return &fixedFuncVersion{
+		f:       f,
+		version: version,
+		drained: make(chan struct{}),
+	}
+}
+
+func (v *fixedFuncVersion) acquire() {
+	v.mu.Lock()
+	v.pending++
+	v.mu.Unlock()
+}
+
+func (v *fixedFuncVersion) release() {
+	v.mu.Lock()
+	v.pending--
+	if v.retired && v.pending == 0 {
+		close(v.drained)
 	}
+	v.mu.Unlock()
+}
 
-	// check paused
-	if len(p.pool.pause) > 0 {
-		return nil, ErrPoolPaused
+// retire mark version replaced, no more tasks acquire it afterwards.
+func (v *fixedFuncVersion) retire() {
+	v.mu.Lock()
+	v.retired = true
+	if v.pending == 0 {
+		close(v.drained)
 	}
+	v.mu.Unlock()
+}
 
-	p.pool.taskQ <- rscPool.GetTask(func() (interface{}, error) { return p.f(arg) }, rc)
-	p.pool.scale()
+func newFixedFuncPool(f FixedFunc, o *options) *FixedFuncPool {
+	p := &FixedFuncPool{
+		pool: newBasicPool(o, defaultTaskQueueCapacity),
+		fn:   newFixedFuncVersion(f, 1),
+	}
+	if o.breaker != nil {
+		p.breaker = newCircuitBreaker(*o.breaker, o.clock)
+	}
+	if o.dedup != nil {
+		p.dedup = o.dedup
+		p.inflight = make(map[string]*dedupCall)
+	}
+	if o.cache != nil {
+		p.cache = newResultCache(*o.cache, o.clock)
+	}
+	return p
+}
 
-	return newPondFuture(rc), nil
+func (p *FixedFuncPool) Submit(arg interface{}) (Future, error) {
+	return p.submit(arg, 1, -1)
 }
 
 func (p *FixedFuncPool) SubmitWithTimeout(arg interface{}, timeout time.Duration) (Future, error) {
-	// not all callers hold the returned Future, so that there may no
-	// receiver side which may cause block when worker send return values.
-	rc := make(chan *taskResult, 1)
+	return p.submit(arg, 1, timeout)
+}
 
-	// check closed
-	select {
-	case <-p.pool.close:
-		return nil, ErrPoolClosed
-	default:
+// SubmitWithCost submit arg which consume tokens of rate limit, see
+// WithRateLimit, ErrTaskCost returned if tokens is less than one.
+func (p *FixedFuncPool) SubmitWithCost(arg interface{}, tokens int) (Future, error) {
+	return p.submit(arg, tokens, -1)
+}
+
+// submit pack the fixed function call with arg as a task and submit it,
+// or return the cached result, or attach to the in-flight call with the
+// same dedup key.
+func (p *FixedFuncPool) submit(arg interface{}, cost int, timeout time.Duration) (Future, error) {
+	var done func(uint64, interface{}, error)
+	if p.cache != nil {
+		key := p.cache.cfg.Key(arg)
+		if entry, ok := p.cache.get(key); ok {
+			atomic.AddUint64(&p.pool.stats.cacheHits, 1)
+			future := newCompletedFuture(entry.val, entry.err)
+			future.version = entry.version
+			return future, nil
+		}
+		atomic.AddUint64(&p.pool.stats.cacheMisses, 1)
+		done = p.cache.setter(key)
+	}
+	if p.dedup == nil {
+		return p.submitCall(arg, cost, timeout, done)
 	}
 
-	// check paused
-	if len(p.pool.pause) > 0 {
-		return nil, ErrPoolPaused
+	key := p.dedup(arg)
+	p.dedupMu.Lock()
+	if call, ok := p.inflight[key]; ok {
+		p.dedupMu.Unlock()
+		if err := call.wait(timeout); err != nil {
+			return nil, err
+		}
+		atomic.AddUint64(&p.pool.stats.coalesced, 1)
+		return call.future, call.err
 	}
+	call := &dedupCall{ready: make(chan struct{})}
+	p.inflight[key] = call
+	p.dedupMu.Unlock()
 
-	select {
-	case <-time.After(timeout):
-		return nil, ErrTaskTimeout
-	case p.pool.taskQ <- rscPool.GetTask(func() (interface{}, error) { return p.f(arg) }, rc):
+	// lock is not held while submitting, which may block on task queue.
+	forget := func() {
+		p.dedupMu.Lock()
+		// map may be reset by SetNewFixedFunc, only remove this call.
+		if p.inflight[key] == call {
+			delete(p.inflight, key)
+		}
+		p.dedupMu.Unlock()
+	}
+	call.future, call.err = p.submitCall(arg, cost, timeout, func(version uint64, val interface{}, err error) {
+		if done != nil {
+			done(version, val, err)
+		}
+		forget()
+	})
+	if call.err != nil {
+		forget()
+	}
+	close(call.ready)
+	return call.future, call.err
+}
+
+// submitCall submit a call of current fixed function with arg, it fails
+// fast with ErrCircuitOpen if circuit breaker is open. done is invoked with
+// results and function version after call returned if not nil.
+func (p *FixedFuncPool) submitCall(arg interface{}, cost int, timeout time.Duration, done func(uint64, interface{}, error)) (Future, error) {
+	var gen uint64
+	if p.breaker != nil {
+		var err error
+		if gen, err = p.breaker.allow(); err != nil {
+			return nil, err
+		}
 	}
 
-	p.pool.scale()
+	p.fnMu.RLock()
+	v := p.fn
+	v.acquire()
+	p.fnMu.RUnlock()
 
-	return newPondFuture(rc), nil
+	call := func(interface{}) (val interface{}, err error) {
+		defer v.release()
+		if p.breaker == nil {
+			return v.f(arg)
+		}
+		// breaker may trip or turn half-open while task queued.
+		if !p.breaker.admit(gen) {
+			return nil, ErrCircuitOpen
+		}
+		// a panicking call is recorded as failure, err is left as it is
+		// if v.f panics.
+		err = ErrTaskPanicked
+		defer func() {
+			p.breaker.record(gen, err)
+		}()
+		return v.f(arg)
+	}
+
+	if done != nil {
+		inner := call
+		call = func(state interface{}) (val interface{}, err error) {
+			// a panicking call is done with ErrTaskPanicked.
+			err = ErrTaskPanicked
+			defer func() {
+				done(v.version, val, err)
+			}()
+			return inner(state)
+		}
+	}
+
+	te := rscPool.GetTask(call, nil)
+	te.cost = cost
+	te.onDrop(v.release)
+	if p.breaker != nil {
+		te.onDrop(func() {
+			p.breaker.cancel(gen)
+		})
+	}
+	if done != nil {
+		te.onDrop(func() {
+			done(v.version, nil, ErrPoolClosed)
+		})
+	}
+	future, err := p.pool.submit(te, timeout)
+	if err != nil {
+		if p.breaker != nil {
+			p.breaker.cancel(gen)
+		}
+		v.release()
+		return nil, err
+	}
+	future.(*pondFuture).version = v.version
+	return future, nil
+}
+
+// BreakerState return current state of circuit breaker, it is always
+// BreakerClosed if pool is not guarded by circuit breaker.
+func (p *FixedFuncPool) BreakerState() BreakerState {
+	if p.breaker == nil {
+		return BreakerClosed
+	}
+	return p.breaker.State()
 }
 
 func (p *FixedFuncPool) SetCapacity(newCap int) {
 	p.pool.SetCapacity(newCap)
 }
 
-// SetNewFixedFunc dynamically set new fixed function hold inside
-// pool, it will paused util old tasks done.
-func (p *FixedFuncPool) SetNewFixedFunc(newFunc FixedFunc) {
-	// pause the service, equivalent to a LOCK.
-	p.Pause()
-	empty := make(chan struct{})
-
-	emptyChecker := func(ctx context.Context) {
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			default:
-				curLen := len(p.pool.taskQ)
-				if curLen == 0 {
-					empty <- struct{}{}
-					return
-				}
-				// control the checking-frequency
-				time.Sleep(time.Millisecond * time.Duration(curLen))
-			}
-		}
+// SetNewFixedFunc dynamically replace the fixed function hold inside
+// pool without pausing it, and return the new version. Tasks submitted
+// afterwards run on the new function, while tasks submitted before keep
+// running on the old one, it returns after all of them done or dropped
+// by Close. Futures returned by Submit methods are VersionedFuture.
+func (p *FixedFuncPool) SetNewFixedFunc(newFunc FixedFunc) uint64 {
+	p.fnMu.Lock()
+	old := p.fn
+	p.fn = newFixedFuncVersion(newFunc, old.version+1)
+	version := p.fn.version
+	old.retire()
+	p.fnMu.Unlock()
+
+	// results and in-flight calls of old function are not shared with
+	// new submissions.
+	if p.cache != nil {
+		p.cache.purge()
 	}
-	ctx, cancel := context.WithCancel(context.Background())
-	go emptyChecker(ctx)
-	// wait for old tasks done
-	<-empty
-	cancel()
-	// set new function
-	p.f = newFunc
-	// resume the service
-	p.Resume()
+	if p.dedup != nil {
+		p.dedupMu.Lock()
+		p.inflight = make(map[string]*dedupCall)
+		p.dedupMu.Unlock()
+	}
+
+	<-old.drained
+	return version
+}
+
+// Version return the version of current fixed function, it starts from 1
+// and increases when fixed function replaced.
+func (p *FixedFuncPool) Version() uint64 {
+	p.fnMu.RLock()
+	defer p.fnMu.RUnlock()
+	return p.fn.version
 }
 
 func (p *FixedFuncPool) Pause() {
@@ -141,13 +327,20 @@ func (p *FixedFuncPool) Resume() {
 
 func (p *FixedFuncPool) Close() {
 	p.pool.Close()
-	p.f = nil
 }
 
 func (p *FixedFuncPool) SetPurgeDuration(dur time.Duration) {
 	p.pool.SetPurgeDuration(dur)
 }
 
+func (p *FixedFuncPool) State() PoolState {
+	return p.pool.State()
+}
+
+func (p *FixedFuncPool) RunningTasks() []RunningTask {
+	return p.pool.RunningTasks()
+}
+
 func (p *FixedFuncPool) Capacity() int {
 	return p.pool.Capacity()
 }
@@ -155,3 +348,7 @@ func (p *FixedFuncPool) Capacity() int {
 func (p *FixedFuncPool) Workers() int {
 	return p.pool.Workers()
 }
+
+func (p *FixedFuncPool) Stats() Stats {
+	return p.pool.Stats()
+}
@@ -1,7 +1,9 @@
 package pond
 
 import (
+	"errors"
 	"fmt"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -34,6 +36,8 @@ func TestBasicPoolPause(t *testing.T) {
 	pool := NewPool()
 	_, _ = pool.Submit(foo)
 	pool.Pause()
+	// pausing paused pool is a no-op.
+	pool.Pause()
 	_, err := pool.Submit(foo)
 	if err == nil || err != ErrPoolPaused {
 		t.Error("pool has paused, no more tasks submitted!")
@@ -44,6 +48,8 @@ func TestBasicPoolPause(t *testing.T) {
 		t.Error("pool has resumed and should works well.")
 	}
 	pool.Close()
+	// pausing closed pool is a no-op.
+	pool.Pause()
 }
 
 func TestBasicPoolClose(t *testing.T) {
@@ -74,3 +80,224 @@ func TestBasicPoolSetCapacity(t *testing.T) {
 	pool.Close()
 	fmt.Println(t.Name() + " Done")
 }
+
+func TestBasicPoolCloseQueued(t *testing.T) {
+	fmt.Println(t.Name())
+	pool := NewPool(1)
+	block := make(chan struct{})
+	running, _ := pool.Submit(func() (interface{}, error) {
+		<-block
+		return nil, nil
+	})
+	time.Sleep(10 * time.Millisecond)
+	queued, _ := pool.Submit(foo)
+	pool.Close()
+	close(block)
+	if _, err := running.Value(); err != nil {
+		t.Error("running task should be done after pool closed:", err)
+	}
+	if _, err := queued.Value(); err != ErrPoolClosed {
+		t.Error("queued task should be failed with ErrPoolClosed after pool closed")
+	}
+}
+
+type countingWorker struct {
+	taskQ <-chan *TaskEnvelope
+	close chan struct{}
+	inits *int32
+}
+
+func (cw *countingWorker) Init() error {
+	atomic.AddInt32(cw.inits, 1)
+	return nil
+}
+
+func (cw *countingWorker) Run() {
+	for {
+		select {
+		case <-cw.close:
+			return
+		case te, ok := <-cw.taskQ:
+			if !ok {
+				return
+			}
+			val, err := te.Task()()
+			te.Report(fmt.Sprint("custom:", val), err)
+		}
+	}
+}
+
+func (cw *countingWorker) Idle() bool { return false }
+
+func (cw *countingWorker) Close() { close(cw.close) }
+
+func TestCustomizedWorkerPool(t *testing.T) {
+	fmt.Println(t.Name())
+	var inits int32
+	pool := NewCustomizedWorkerPool(func(tq <-chan *TaskEnvelope) Worker {
+		return &countingWorker{taskQ: tq, close: make(chan struct{}), inits: &inits}
+	}, 2)
+	if atomic.LoadInt32(&inits) != 2 {
+		t.Error("pool should initialize every worker")
+	}
+	future, _ := pool.Submit(func() (interface{}, error) { return 1, nil })
+	if val, _ := future.Value(); val != "custom:1" {
+		t.Errorf("task should be run by customized worker, got %v", val)
+	}
+	pool.Close()
+}
+
+type failingWorker struct {
+	countingWorker
+	fails *int32
+}
+
+func (fw *failingWorker) Init() error {
+	if atomic.AddInt32(fw.fails, -1) >= 0 {
+		return errors.New("init failed")
+	}
+	return fw.countingWorker.Init()
+}
+
+func TestBasicPoolWorkerInitError(t *testing.T) {
+	fmt.Println(t.Name())
+	var inits, errs int32
+	fails := int32(2)
+	pool := NewPoolWithOptions(WithCapacity(2), WithErrorHandler(func(err error) {
+		if errors.Is(err, ErrWorkerInit) {
+			atomic.AddInt32(&errs, 1)
+		}
+	}), WithWorkerCtor(func(tq <-chan *TaskEnvelope) Worker {
+		return &failingWorker{countingWorker{taskQ: tq, close: make(chan struct{}), inits: &inits}, &fails}
+	}))
+	if pool.Workers() != 0 || atomic.LoadInt32(&errs) != 2 {
+		t.Error("workers failed to initialize should be discarded and reported")
+	}
+	future, _ := pool.Submit(func() (interface{}, error) { return 1, nil })
+	if val, _ := future.Value(); val != "custom:1" {
+		t.Errorf("worker should be spawned again on submission, got %v", val)
+	}
+	pool.Close()
+}
+
+func TestBasicPoolWorkerState(t *testing.T) {
+	fmt.Println(t.Name())
+	var inits, cleanups int32
+	pool := NewPoolWithOptions(WithCapacity(2), WithWorkerState(
+		func() (interface{}, error) {
+			atomic.AddInt32(&inits, 1)
+			return make([]byte, 0, 16), nil
+		},
+		func(state interface{}) {
+			atomic.AddInt32(&cleanups, 1)
+		},
+	))
+	future, _ := pool.(StatefulSubmitter).SubmitWithState(func(state interface{}) (interface{}, error) {
+		return cap(state.([]byte)), nil
+	})
+	if val, _ := future.Value(); val != 16 {
+		t.Errorf("task should receive the worker state, got %v", val)
+	}
+	pool.SetCapacity(1)
+	pool.Close()
+	time.Sleep(10 * time.Millisecond)
+	if i, c := atomic.LoadInt32(&inits), atomic.LoadInt32(&cleanups); i != 2 || c != 2 {
+		t.Errorf("every worker state should be initialized and cleaned up, got %d/%d", i, c)
+	}
+}
+
+func TestBasicPoolLockOSThread(t *testing.T) {
+	fmt.Println(t.Name())
+	pool := NewPoolWithOptions(WithCapacity(2), WithLockOSThread(0))
+	for i := 0; i < 4; i++ {
+		future, _ := pool.Submit(foo)
+		if _, err := future.Value(); err != nil {
+			t.Error("task should be done by locked worker:", err)
+		}
+	}
+	pool.SetCapacity(1)
+	pool.Close()
+}
+
+func TestBasicPoolLockOSThreadPinError(t *testing.T) {
+	fmt.Println(t.Name())
+	var errs int32
+	pool := NewPoolWithOptions(WithCapacity(2), WithLockOSThread(-1), WithErrorHandler(func(err error) {
+		if errors.Is(err, ErrInvalidCPU) || errors.Is(err, ErrAffinityUnsupported) {
+			atomic.AddInt32(&errs, 1)
+		}
+	}))
+	if atomic.LoadInt32(&errs) != 2 {
+		t.Error("pinning failure of every worker should be reported")
+	}
+	future, _ := pool.Submit(foo)
+	if _, err := future.Value(); err != nil {
+		t.Error("task should be done by unpinned worker:", err)
+	}
+	pool.Close()
+}
+
+func TestBasicPoolForwardUnlocked(t *testing.T) {
+	fmt.Println(t.Name())
+	pool := newBasicPool(newOptions(WithCapacity(1)), 1)
+	block := make(chan struct{})
+	task := func() (interface{}, error) {
+		<-block
+		return nil, nil
+	}
+	// one task running and one queued, the next forwarded one blocks.
+	_, _ = pool.Submit(task)
+	time.Sleep(10 * time.Millisecond)
+	_, _ = pool.Submit(task)
+	go pool.forward(rscPool.GetTask(statelessTask(task), make(chan *taskResult, 1)), pool.taskQ)
+	time.Sleep(10 * time.Millisecond)
+
+	done := make(chan struct{})
+	go func() {
+		pool.SetCapacity(2)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("forwarding into full queue should not block SetCapacity")
+	}
+	close(block)
+	pool.Close()
+}
+
+func TestBasicPoolRunningTasks(t *testing.T) {
+	fmt.Println(t.Name())
+	pool := NewPoolWithOptions(WithCapacity(2), WithRunningTasks())
+	release := make(chan struct{})
+	for i := 0; i < 2; i++ {
+		started := make(chan struct{})
+		_, _ = pool.Submit(func() (interface{}, error) {
+			close(started)
+			<-release
+			return nil, nil
+		})
+		<-started
+		time.Sleep(time.Millisecond)
+	}
+	tasks := pool.(TaskInspector).RunningTasks()
+	close(release)
+	if len(tasks) != 2 || tasks[0].Elapsed < tasks[1].Elapsed {
+		t.Errorf("longest running task should come first, got %+v", tasks)
+	}
+	pool.Close()
+
+	pool = NewPoolWithOptions(WithCapacity(1))
+	started, block := make(chan struct{}), make(chan struct{})
+	_, _ = pool.Submit(func() (interface{}, error) {
+		close(started)
+		<-block
+		return nil, nil
+	})
+	<-started
+	if tasks := pool.(TaskInspector).RunningTasks(); len(tasks) != 0 {
+		t.Error("running tasks should not be tracked unless enabled")
+	}
+	close(block)
+	pool.Close()
+}
@@ -0,0 +1,121 @@
+package pond
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// tokenBucket is a token bucket refilled at rate tokens per second,
+// holding at most burst tokens.
+type tokenBucket struct {
+	clock Clock
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int, clock Clock) *tokenBucket {
+	return &tokenBucket{
+		clock:  clock,
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   clock.Now(),
+	}
+}
+
+// take consume n tokens if available, otherwise nothing consumed and
+// return the duration to wait until enough tokens refilled.
+func (b *tokenBucket) take(n int) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.clock.Now()
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed.Seconds()*b.rate)
+		b.last = now
+	}
+	if need := float64(n) - b.tokens; need > 0 {
+		return time.Duration(math.Ceil(need / b.rate * float64(time.Second)))
+	}
+	b.tokens -= float64(n)
+	return 0
+}
+
+// dispatchRateLimited forward tasks from rateQ to limitQ or taskQ in the
+// pace of token bucket, tasks wait here instead of holding workers. A task
+// is forwarded only when a worker is free, so that tokens are taken right
+// before it starts rather than tasks paid piling up in taskQ. It stops
+// forwarding while pool paused.
+func (bp *basicPool) dispatchRateLimited() {
+	for {
+		select {
+		case <-bp.close:
+			return
+		case te := <-bp.rateQ:
+			if !bp.waitWorker() || !bp.waitTokens(te.cost) || !bp.forward(te, bp.limitedQueue()) {
+				te.drop(ErrPoolClosed)
+				return
+			}
+		}
+	}
+}
+
+// waitWorker block until a worker is free of running and queued tasks,
+// return false if pool closed.
+func (bp *basicPool) waitWorker() bool {
+	for bp.busyWorkers()+len(bp.limitQ) >= bp.Workers() {
+		select {
+		case <-bp.close:
+			return false
+		case <-time.After(defaultPauseCheckInterval):
+		}
+	}
+	return true
+}
+
+// waitTokens block until n tokens taken from bucket while pool not
+// paused, return false if pool closed.
+func (bp *basicPool) waitTokens(n int) bool {
+	for {
+		if !bp.waitResumed() {
+			return false
+		}
+		wait := bp.bucket.take(n)
+		if wait == 0 {
+			return true
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-bp.close:
+			timer.Stop()
+			return false
+		case <-timer.C:
+		}
+	}
+}
+
+// waitResumed block while pool paused, return false if pool closed.
+func (bp *basicPool) waitResumed() bool {
+	return bp.waitResumedContext(context.Background()) == nil
+}
+
+// waitResumedContext block while pool paused, return ErrPoolClosed if
+// pool closed or ctx.Err() if ctx done.
+func (bp *basicPool) waitResumedContext(ctx context.Context) error {
+	for bp.paused() {
+		select {
+		case <-bp.close:
+			return ErrPoolClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(defaultPauseCheckInterval):
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package pond
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	fmt.Println(t.Name())
+	clock := &fakeClock{}
+	b := newTokenBucket(10, 2, clock)
+	if b.take(2) != 0 {
+		t.Error("bucket should be full initially")
+	}
+	if wait := b.take(1); wait != 100*time.Millisecond {
+		t.Errorf("should wait for one token refilled, got %v", wait)
+	}
+	clock.advance(time.Second)
+	if b.take(2) != 0 || b.take(1) == 0 {
+		t.Error("refilled tokens should not exceed burst")
+	}
+}
+
+func TestBasicPoolRateLimit(t *testing.T) {
+	fmt.Println(t.Name())
+	pool := NewPoolWithOptions(WithCapacity(4), WithRateLimit(100, 1))
+	beg := time.Now()
+	var futures []Future
+	for i := 0; i < 5; i++ {
+		future, _ := pool.Submit(foo)
+		futures = append(futures, future)
+	}
+	for _, future := range futures {
+		_, _ = future.Value()
+	}
+	if elapsed := time.Since(beg); elapsed < 40*time.Millisecond {
+		t.Errorf("tasks should be started at limited rate, done in %v", elapsed)
+	}
+	if _, err := pool.(CostSubmitter).SubmitWithCost(foo, 2); err != ErrTaskCost {
+		t.Error("task costing more than burst should be rejected")
+	}
+	if _, err := pool.(CostSubmitter).SubmitWithCost(foo, -1); err != ErrTaskCost {
+		t.Error("task costing less than one token should be rejected")
+	}
+	pool.Close()
+}
+
+func TestBasicPoolRateLimitBusy(t *testing.T) {
+	fmt.Println(t.Name())
+	pool := NewPoolWithOptions(WithCapacity(1), WithRateLimit(20, 0))
+	defer pool.Close()
+	release, started := make(chan struct{}), make(chan struct{})
+	_, err := pool.Submit(func() (interface{}, error) {
+		close(started)
+		<-release
+		return nil, nil
+	})
+	if err != nil {
+		t.Error("task should be submitted with burst defaulted:", err)
+		return
+	}
+	<-started
+
+	starts := make(chan time.Time, 3)
+	var futures []Future
+	for i := 0; i < 3; i++ {
+		future, _ := pool.Submit(func() (interface{}, error) {
+			starts <- time.Now()
+			return nil, nil
+		})
+		futures = append(futures, future)
+	}
+	// tokens refilled while worker busy are not spent ahead.
+	time.Sleep(200 * time.Millisecond)
+	close(release)
+	for _, future := range futures {
+		_, _ = future.Value()
+	}
+	first := <-starts
+	<-starts
+	if last := <-starts; last.Sub(first) < 80*time.Millisecond {
+		t.Errorf("tasks should be started at limited rate after worker freed, started within %v", last.Sub(first))
+	}
+}
+
+func TestFixedFuncPoolRateLimitClose(t *testing.T) {
+	fmt.Println(t.Name())
+	pool := NewFixedFuncPoolWithOptions(fooPow, WithCapacity(1), WithRateLimit(0.001, 1))
+	future, _ := pool.SubmitWithCost(2, 1)
+	if val, _ := future.Value(); val != 4 {
+		t.Error("execution result should be 4!")
+	}
+	// no more tokens, the task waits in rate queue until pool closed.
+	_, _ = pool.Submit(3)
+	done := make(chan struct{})
+	go func() {
+		pool.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("closing pool should not be blocked by rate limit")
+	}
+}
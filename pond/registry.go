@@ -0,0 +1,165 @@
+package pond
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// defaultPoolName is the name of process-wide default pool in registry.
+const defaultPoolName = "default"
+
+// PoolInfo describe a registered pool, State, Capacity and Stats are zero
+// if pool does not report them, pools of this package report all of them.
+type PoolInfo struct {
+	Name     string
+	State    PoolState
+	Capacity int
+	Workers  int
+	Stats    Stats
+}
+
+// registry hold named pools of process, so that libraries can share pools
+// and they can be inspected and closed together.
+type registry struct {
+	mu    sync.RWMutex
+	pools map[string]ManagedPool
+	// def is the lazily created default pool, nil if not created.
+	def Pool
+}
+
+var (
+	_ ManagedPool = (*FixedFuncPool)(nil)
+	_ ManagedPool = (*BatchFuncPool)(nil)
+)
+
+// stateReporter and capacityReporter are implemented by pools reporting
+// their state and capacity.
+type stateReporter interface {
+	State() PoolState
+}
+
+type capacityReporter interface {
+	Capacity() int
+}
+
+var pools = &registry{pools: make(map[string]ManagedPool)}
+
+// Register add pool to registry by name, ErrPoolRegistered returned if
+// the name is taken. A pool registered as "default" is returned by
+// Default, so it must be a Pool, otherwise ErrDefaultPool returned.
+func Register(name string, pool ManagedPool) error {
+	if pool == nil {
+		return ErrPoolNil
+	}
+	def, ok := pool.(Pool)
+	if name == defaultPoolName && !ok {
+		return ErrDefaultPool
+	}
+	pools.mu.Lock()
+	defer pools.mu.Unlock()
+	if _, ok := pools.pools[name]; ok {
+		return ErrPoolRegistered
+	}
+	pools.pools[name] = pool
+	if name == defaultPoolName {
+		pools.def = def
+	}
+	return nil
+}
+
+// Unregister remove pool of name from registry, the pool is not closed.
+func Unregister(name string) {
+	pools.mu.Lock()
+	defer pools.mu.Unlock()
+	if name == defaultPoolName {
+		pools.def = nil
+	}
+	delete(pools.pools, name)
+}
+
+// Get return the registered pool of name.
+func Get(name string) (ManagedPool, bool) {
+	pools.mu.RLock()
+	defer pools.mu.RUnlock()
+	pool, ok := pools.pools[name]
+	return pool, ok
+}
+
+// Default return the process-wide default pool, it is created with
+// DefaultCapacity on first call and registered as "default" unless a pool
+// has been registered by that name, so that libraries share one pool
+// rather than spawning their own.
+func Default() Pool {
+	pools.mu.RLock()
+	def := pools.def
+	pools.mu.RUnlock()
+	if def != nil {
+		return def
+	}
+
+	pools.mu.Lock()
+	defer pools.mu.Unlock()
+	if pools.def == nil {
+		pools.def = NewPool()
+		pools.pools[defaultPoolName] = pools.def
+	}
+	return pools.def
+}
+
+// Pools return information of all registered pools, sorted by name.
+func Pools() []PoolInfo {
+	pools.mu.RLock()
+	infos := make([]PoolInfo, 0, len(pools.pools))
+	for name, pool := range pools.pools {
+		info := PoolInfo{Name: name, Workers: pool.Workers()}
+		if reporter, ok := pool.(stateReporter); ok {
+			info.State = reporter.State()
+		}
+		if reporter, ok := pool.(capacityReporter); ok {
+			info.Capacity = reporter.Capacity()
+		}
+		if reporter, ok := pool.(StatsReporter); ok {
+			info.Stats = reporter.Stats()
+		}
+		infos = append(infos, info)
+	}
+	pools.mu.RUnlock()
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
+
+// CloseAll close and unregister all registered pools concurrently, it
+// returns ctx.Err() if ctx done before all pools closed, remaining pools
+// keep closing in background.
+func CloseAll(ctx context.Context) error {
+	pools.mu.Lock()
+	closing := pools.pools
+	pools.pools = make(map[string]ManagedPool)
+	pools.def = nil
+	pools.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, pool := range closing {
+		wg.Add(1)
+		go func(pool ManagedPool) {
+			defer wg.Done()
+			pool.Close()
+		}(pool)
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,146 @@
+package pond
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRegistry(t *testing.T) {
+	fmt.Println(t.Name())
+	defer CloseAll(context.Background())
+
+	p := NewPool(2)
+	if err := Register("a", p); err != nil {
+		t.Error("pool should be registered:", err)
+	}
+	if err := Register("a", p); err != ErrPoolRegistered {
+		t.Error("name of registered pool should not be taken again")
+	}
+	if err := Register("nil", nil); err != ErrPoolNil {
+		t.Error("nil pool should not be registered")
+	}
+	fp := NewFixedFuncPool(func(arg interface{}) (interface{}, error) { return arg, nil }, 2)
+	if err := Register("b", fp); err != nil {
+		t.Error("fixed func pool should be registered:", err)
+	}
+
+	if got, ok := Get("a"); !ok || got != ManagedPool(p) {
+		t.Error("registered pool should be got by name")
+	}
+	if _, ok := Get("c"); ok {
+		t.Error("pool not registered should not be got")
+	}
+
+	def := Default()
+	if Default() != def {
+		t.Error("default pool should be created once")
+	}
+	future, err := def.Submit(func() (interface{}, error) { return 1, nil })
+	if err != nil {
+		t.Error("default pool should accept tasks:", err)
+	} else if val, _ := future.Value(); val != 1 {
+		t.Error("execution result should be 1!")
+	}
+
+	infos := Pools()
+	if len(infos) != 3 {
+		t.Errorf("all registered pools should be listed, got %d", len(infos))
+	} else {
+		for i, name := range []string{"a", "b", defaultPoolName} {
+			if infos[i].Name != name {
+				t.Errorf("pools should be sorted by name, got %s at %d", infos[i].Name, i)
+			}
+		}
+		if infos[0].Capacity != 2 || infos[0].State != PoolRunning {
+			t.Errorf("capacity and state of pool should be reported, got %+v", infos[0])
+		}
+		if infos[2].Stats.Completed != 1 {
+			t.Errorf("stats of default pool should count its task, got %+v", infos[2].Stats)
+		}
+	}
+
+	Unregister("a")
+	if _, ok := Get("a"); ok {
+		t.Error("unregistered pool should not be got")
+	}
+	p.Close()
+
+	if err := CloseAll(context.Background()); err != nil {
+		t.Error("all pools should be closed:", err)
+	}
+	if len(Pools()) != 0 {
+		t.Error("no pool should be registered after CloseAll")
+	}
+	if _, err := fp.Submit(1); err != ErrPoolClosed {
+		t.Error("registered pool should be closed by CloseAll")
+	}
+	if Default() == def {
+		t.Error("a new default pool should be created after CloseAll")
+	}
+}
+
+// minimalPool implements ManagedPool only.
+type minimalPool struct {
+	ManagedPool
+}
+
+func (p minimalPool) Workers() int {
+	return 1
+}
+
+func TestRegistryDefault(t *testing.T) {
+	fmt.Println(t.Name())
+	defer CloseAll(context.Background())
+
+	if err := Register(defaultPoolName, minimalPool{}); err != ErrDefaultPool {
+		t.Error("pool not accepting tasks should not be registered as default")
+	}
+	pool := NewPool(1)
+	if err := Register(defaultPoolName, pool); err != nil {
+		t.Error("pool should be registered as default:", err)
+	}
+	if Default() != pool {
+		t.Error("pool registered as default should be returned by Default")
+	}
+	if got, _ := Get(defaultPoolName); got != ManagedPool(pool) {
+		t.Error("pool registered as default should be kept in registry")
+	}
+}
+
+func TestRegistryMinimalPool(t *testing.T) {
+	fmt.Println(t.Name())
+	if err := Register("minimal", minimalPool{}); err != nil {
+		t.Error("pool should be registered:", err)
+	}
+	defer Unregister("minimal")
+	infos := Pools()
+	if len(infos) != 1 || infos[0].Workers != 1 || infos[0].Capacity != 0 {
+		t.Errorf("pool without optional methods should be listed, got %+v", infos)
+	}
+}
+
+type slowClosePool struct {
+	ManagedPool
+	closed chan struct{}
+}
+
+func (p *slowClosePool) Close() {
+	<-p.closed
+}
+
+func TestRegistryCloseAllContext(t *testing.T) {
+	fmt.Println(t.Name())
+	p := &slowClosePool{closed: make(chan struct{})}
+	defer close(p.closed)
+	if err := Register("slow", p); err != nil {
+		t.Error("pool should be registered:", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := CloseAll(ctx); err != context.DeadlineExceeded {
+		t.Error("CloseAll should return when ctx done")
+	}
+}
@@ -2,9 +2,11 @@ package pond
 
 import "sync"
 
+// resourcePool recycle task results, which are done with once received
+// by Future. Envelopes are not recycled, they may be still referenced
+// after reported, e.g. by DeadlineMiddleware or task registry.
 type resourcePool struct {
-	resPool  *sync.Pool
-	taskPool *sync.Pool
+	resPool *sync.Pool
 }
 
 var rscPool *resourcePool
@@ -15,11 +17,6 @@ func (p *resourcePool) init() {
 			return &taskResult{}
 		},
 	}
-	p.taskPool = &sync.Pool{
-		New: func() interface{} {
-			return &taskWrapper{}
-		},
-	}
 }
 
 func (p *resourcePool) GetTaskResult(val interface{}, err error) *taskResult {
@@ -32,16 +29,12 @@ func (p *resourcePool) PutTaskResult(res *taskResult) {
 	p.resPool.Put(res)
 }
 
-func (p *resourcePool) GetTask(t Task, resChan chan *taskResult) *taskWrapper {
-	task := p.taskPool.Get().(*taskWrapper)
-	task.t, task.resChan = t, resChan
+func (p *resourcePool) GetTask(st StatefulTask, resChan chan *taskResult) *TaskEnvelope {
+	task := &TaskEnvelope{st: st, resChan: resChan, cost: 1}
+	task.t = task.call
 	return task
 }
 
-func (p *resourcePool) PutTask(task *taskWrapper) {
-	p.taskPool.Put(task)
-}
-
 func init() {
 	rscPool = &resourcePool{}
 	rscPool.init()
@@ -0,0 +1,261 @@
+package pond
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a snapshot of pool statistics.
+type Stats struct {
+	// Submitted is the number of tasks accepted by pool.
+	Submitted uint64
+	// Completed is the number of tasks done without error.
+	Completed uint64
+	// Failed is the number of tasks done with error.
+	Failed uint64
+	// Running is the number of tasks under execution.
+	Running int64
+	// Queued is the number of tasks waiting for workers.
+	Queued int
+	// Coalesced is the number of submissions attached to an in-flight
+	// call with the same key, see WithDedupKey.
+	Coalesced uint64
+	// CacheHits and CacheMisses count lookups of result cache, see
+	// WithResultCache.
+	CacheHits   uint64
+	CacheMisses uint64
+	// Stuck is the number of tasks found stuck by watchdog, see
+	// WithWatchdog.
+	Stuck uint64
+	// Supervised is the number of supervised tasks, each of them holds
+	// a reserved worker, see TaskSupervisor.
+	Supervised int64
+	// Tasks break Completed, Failed and Running down by task names, see
+	// TaskOptions. At most defaultMaxTaskNames names are broken down,
+	// tasks of names beyond are counted in total only.
+	Tasks map[string]Stats
+	// SubPools break statistics down by sub-pools, tasks of sub-pools
+	// are also counted by their parent.
+	SubPools map[string]Stats
+}
+
+// StatsReporter is implemented by pools reporting statistics.
+type StatsReporter interface {
+	// Stats return a snapshot of pool statistics.
+	Stats() Stats
+}
+
+// TaskInspector is implemented by pools listing tasks under execution.
+type TaskInspector interface {
+	// RunningTasks return tasks under execution, the longest running
+	// one comes first. It is empty unless enabled by WithRunningTasks.
+	RunningTasks() []RunningTask
+}
+
+// poolStats hold counters of pool, they are updated atomically.
+type poolStats struct {
+	submitted   uint64
+	completed   uint64
+	failed      uint64
+	running     int64
+	coalesced   uint64
+	cacheHits   uint64
+	cacheMisses uint64
+	stuck       uint64
+	supervised  int64
+
+	tasks runningTasks
+
+	namedMu sync.Mutex
+	named   map[string]*poolStats
+}
+
+// RunningTask describe a task under execution, ID, Name and Labels are
+// empty if task submitted without TaskOptions.
+type RunningTask struct {
+	ID      string
+	Name    string
+	Labels  map[string]string
+	Started time.Time
+	Elapsed time.Duration
+}
+
+// runningTasks track start time of tasks under execution if enabled.
+type runningTasks struct {
+	enabled bool
+
+	mu    sync.Mutex
+	seq   uint64
+	tasks map[uint64]*runningTask
+
+	// retire is invoked with worker of a task after done, if the worker
+	// was replaced by watchdog.
+	retire func(w *pondWorker)
+}
+
+type runningTask struct {
+	meta *TaskOptions
+	// worker is nil if task executed by customized worker.
+	worker   *pondWorker
+	started  time.Time
+	reported bool
+	replaced bool
+}
+
+// add track a started task, it returns 0 if tracking not enabled.
+func (rt *runningTasks) add(meta *TaskOptions, worker *pondWorker) uint64 {
+	if !rt.enabled {
+		return 0
+	}
+	task := &runningTask{meta: meta, worker: worker, started: time.Now()}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if rt.tasks == nil {
+		rt.tasks = make(map[uint64]*runningTask)
+	}
+	rt.seq++
+	rt.tasks[rt.seq] = task
+	return rt.seq
+}
+
+func (rt *runningTasks) remove(id uint64) {
+	if id == 0 {
+		return
+	}
+	rt.mu.Lock()
+	task := rt.tasks[id]
+	delete(rt.tasks, id)
+	rt.mu.Unlock()
+	if task.replaced && rt.retire != nil {
+		rt.retire(task.worker)
+	}
+}
+
+// list return running tasks, the longest running one comes first.
+func (rt *runningTasks) list() []RunningTask {
+	now := time.Now()
+	rt.mu.Lock()
+	tasks := make([]RunningTask, 0, len(rt.tasks))
+	for _, task := range rt.tasks {
+		tasks = append(tasks, task.describe(now))
+	}
+	rt.mu.Unlock()
+
+	sort.Slice(tasks, func(i, j int) bool {
+		return tasks[i].Started.Before(tasks[j].Started)
+	})
+	return tasks
+}
+
+func (task *runningTask) describe(now time.Time) RunningTask {
+	rt := RunningTask{Started: task.started, Elapsed: now.Sub(task.started)}
+	if task.meta != nil {
+		rt.ID, rt.Name, rt.Labels = task.meta.ID, task.meta.Name, task.meta.Labels
+	}
+	return rt
+}
+
+// track count running and finished tasks of te, tasks with name are also
+// counted by name. It wraps all middlewares of pool.
+func (s *poolStats) track(te *TaskEnvelope, next Task) Task {
+	meta := te.meta
+	var named *poolStats
+	if meta != nil && meta.Name != "" {
+		named = s.namedStats(meta.Name)
+	}
+	return func() (interface{}, error) {
+		atomic.AddInt64(&s.running, 1)
+		if named != nil {
+			atomic.AddInt64(&named.running, 1)
+		}
+		id := s.tasks.add(meta, te.worker)
+		val, err := next()
+		s.tasks.remove(id)
+		s.done(err)
+		if named != nil {
+			named.done(err)
+		}
+		return val, err
+	}
+}
+
+func (s *poolStats) done(err error) {
+	atomic.AddInt64(&s.running, -1)
+	if err != nil {
+		atomic.AddUint64(&s.failed, 1)
+	} else {
+		atomic.AddUint64(&s.completed, 1)
+	}
+}
+
+// namedStats return counters of tasks with name, it returns nil if name
+// is new and defaultMaxTaskNames names have been counted.
+func (s *poolStats) namedStats(name string) *poolStats {
+	s.namedMu.Lock()
+	defer s.namedMu.Unlock()
+	if s.named == nil {
+		s.named = make(map[string]*poolStats)
+	}
+	named, ok := s.named[name]
+	if !ok {
+		if len(s.named) >= defaultMaxTaskNames {
+			return nil
+		}
+		named = &poolStats{}
+		s.named[name] = named
+	}
+	return named
+}
+
+func (s *poolStats) snapshot() Stats {
+	return Stats{
+		Submitted:   atomic.LoadUint64(&s.submitted),
+		Completed:   atomic.LoadUint64(&s.completed),
+		Failed:      atomic.LoadUint64(&s.failed),
+		Running:     atomic.LoadInt64(&s.running),
+		Coalesced:   atomic.LoadUint64(&s.coalesced),
+		CacheHits:   atomic.LoadUint64(&s.cacheHits),
+		CacheMisses: atomic.LoadUint64(&s.cacheMisses),
+		Stuck:       atomic.LoadUint64(&s.stuck),
+		Supervised:  atomic.LoadInt64(&s.supervised),
+	}
+}
+
+func (s *poolStats) namedSnapshot() map[string]Stats {
+	s.namedMu.Lock()
+	defer s.namedMu.Unlock()
+	if len(s.named) == 0 {
+		return nil
+	}
+	tasks := make(map[string]Stats, len(s.named))
+	for name, named := range s.named {
+		tasks[name] = named.snapshot()
+	}
+	return tasks
+}
+
+// Stats return a snapshot of pool statistics.
+func (bp *basicPool) Stats() Stats {
+	stats := bp.stats.snapshot()
+	stats.Tasks = bp.stats.namedSnapshot()
+	stats.Queued = len(bp.taskQ) + len(bp.rateQ) + len(bp.limitQ)
+	if fair := bp.loadScheduler(); fair != nil {
+		stats.Queued += fair.queued()
+	}
+	if subs := bp.subPools(); len(subs) > 0 {
+		stats.SubPools = make(map[string]Stats, len(subs))
+		for _, sub := range subs {
+			stats.SubPools[sub.name] = sub.Stats()
+		}
+	}
+	return stats
+}
+
+// RunningTasks return tasks under execution, the longest running one
+// comes first. Tasks of sub-pools are also listed by their parent, if
+// tracking of parent enabled.
+func (bp *basicPool) RunningTasks() []RunningTask {
+	return bp.stats.tasks.list()
+}
@@ -0,0 +1,151 @@
+package pond
+
+import (
+	"context"
+	"sync"
+)
+
+// Result is the return values of a task submitted by stream, Index is
+// the order of task received from stream.
+type Result struct {
+	Index int
+	Value interface{}
+	Err   error
+}
+
+// StreamSubmitter is implemented by pools accepting tasks from channels.
+// Streams stop receiving tasks once ctx done, results not delivered yet
+// are discarded then.
+type StreamSubmitter interface {
+	// SubmitStream submit tasks received from channel and return a
+	// channel of results in order of completion.
+	SubmitStream(ctx context.Context, tasks <-chan Task) <-chan Result
+
+	// SubmitStreamOrdered is like SubmitStream, but results are in order
+	// of tasks, at most window results are buffered for reordering.
+	SubmitStreamOrdered(ctx context.Context, tasks <-chan Task, window int) <-chan Result
+}
+
+// SubmitStream submit tasks received from tasks and return a channel of
+// their results in order of completion, it is closed after tasks closed
+// or ctx done, and all results delivered. At most twice the number of
+// workers tasks are in flight, so results not consumed hold back
+// submission.
+func (bp *basicPool) SubmitStream(ctx context.Context, tasks <-chan Task) <-chan Result {
+	window := 2 * bp.Workers()
+	if window < 1 {
+		window = 1
+	}
+	out := make(chan Result)
+	go func() {
+		defer close(out)
+		var wg sync.WaitGroup
+		defer wg.Wait()
+		slots := make(chan struct{}, window)
+		for index := 0; ; index++ {
+			task, ok := receiveTask(ctx, tasks, slots)
+			if !ok {
+				return
+			}
+			wg.Add(1)
+			go func(index int, resChan chan *taskResult) {
+				defer wg.Done()
+				select {
+				case out <- bp.streamResult(ctx, index, resChan):
+				case <-ctx.Done():
+				}
+				<-slots
+			}(index, bp.streamTask(ctx, task))
+		}
+	}()
+	return out
+}
+
+// SubmitStreamOrdered is like SubmitStream, but results are delivered in
+// order of tasks. At most window tasks are in flight or wait for earlier
+// ones in reorder buffer.
+func (bp *basicPool) SubmitStreamOrdered(ctx context.Context, tasks <-chan Task, window int) <-chan Result {
+	if window < 1 {
+		window = 1
+	}
+	out := make(chan Result)
+	slots := make(chan struct{}, window)
+	// pending never blocks, because its senders hold slots.
+	pending := make(chan chan *taskResult, window)
+	go func() {
+		defer close(pending)
+		for {
+			task, ok := receiveTask(ctx, tasks, slots)
+			if !ok {
+				return
+			}
+			pending <- bp.streamTask(ctx, task)
+		}
+	}()
+	go func() {
+		defer close(out)
+		index := 0
+		for resChan := range pending {
+			select {
+			case out <- bp.streamResult(ctx, index, resChan):
+			case <-ctx.Done():
+				return
+			}
+			<-slots
+			index++
+		}
+	}()
+	return out
+}
+
+// receiveTask take a slot and receive the next task, return false if
+// tasks closed or ctx done.
+func receiveTask(ctx context.Context, tasks <-chan Task, slots chan struct{}) (Task, bool) {
+	select {
+	case slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, false
+	}
+	select {
+	case task, ok := <-tasks:
+		return task, ok
+	case <-ctx.Done():
+		return nil, false
+	}
+}
+
+// streamTask push task into task queue as soon as pool is not paused,
+// return the channel its result reported to.
+func (bp *basicPool) streamTask(ctx context.Context, task Task) chan *taskResult {
+	resChan := make(chan *taskResult, 1)
+	te := rscPool.GetTask(statelessTask(task), resChan)
+	err := bp.waitResumedContext(ctx)
+	if err == nil {
+		err = bp.dispatchContext(ctx, te)
+	}
+	if err != nil {
+		te.drop(err)
+	}
+	return resChan
+}
+
+// streamResult wait for result of task, it gives ErrPoolClosed if pool
+// closed and ctx.Err() if ctx done before task done.
+func (bp *basicPool) streamResult(ctx context.Context, index int, resChan chan *taskResult) Result {
+	var res *taskResult
+	select {
+	case res = <-resChan:
+	case <-bp.close:
+		// prefer result of task done before closed.
+		select {
+		case res = <-resChan:
+		default:
+			return Result{Index: index, Err: ErrPoolClosed}
+		}
+	case <-ctx.Done():
+		return Result{Index: index, Err: ctx.Err()}
+	}
+	result := Result{Index: index, Value: res.val, Err: res.err}
+	rscPool.PutTaskResult(res)
+	return result
+}
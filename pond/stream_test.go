@@ -0,0 +1,165 @@
+package pond
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func streamTasks(n int, started *int32) <-chan Task {
+	tasks := make(chan Task)
+	go func() {
+		defer close(tasks)
+		for i := 0; i < n; i++ {
+			i := i
+			tasks <- func() (interface{}, error) {
+				atomic.AddInt32(started, 1)
+				time.Sleep(time.Duration(n-i) * 100 * time.Microsecond)
+				return i, nil
+			}
+		}
+	}()
+	return tasks
+}
+
+func TestSubmitStream(t *testing.T) {
+	fmt.Println(t.Name())
+	pool := NewPool(4)
+	defer pool.Close()
+
+	var started int32
+	seen := make(map[int]bool)
+	for res := range pool.(StreamSubmitter).SubmitStream(context.Background(), streamTasks(100, &started)) {
+		if res.Err != nil || res.Value != res.Index {
+			t.Errorf("result should match its index, got %+v", res)
+		}
+		seen[res.Index] = true
+	}
+	if len(seen) != 100 {
+		t.Errorf("every task should have a result, got %d", len(seen))
+	}
+}
+
+func TestSubmitStreamOrdered(t *testing.T) {
+	fmt.Println(t.Name())
+	pool := NewPool(4)
+	defer pool.Close()
+
+	var started int32
+	next := 0
+	for res := range pool.(StreamSubmitter).SubmitStreamOrdered(context.Background(), streamTasks(100, &started), 8) {
+		if res.Err != nil || res.Index != next || res.Value != next {
+			t.Errorf("results should be in order of tasks, expect %d, got %+v", next, res)
+		}
+		next++
+	}
+	if next != 100 {
+		t.Errorf("every task should have a result, got %d", next)
+	}
+}
+
+func TestSubmitStreamBackpressure(t *testing.T) {
+	fmt.Println(t.Name())
+	pool := NewPool(2)
+	defer pool.Close()
+	streams := pool.(StreamSubmitter)
+
+	var started int32
+	results := streams.SubmitStreamOrdered(context.Background(), streamTasks(100, &started), 4)
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt32(&started); n > 4 {
+		t.Errorf("submission should be held back by consumer, got %d started", n)
+	}
+	for range results {
+	}
+
+	atomic.StoreInt32(&started, 0)
+	results = streams.SubmitStream(context.Background(), streamTasks(100, &started))
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt32(&started); n > 4 {
+		t.Errorf("submission should be held back by consumer, got %d started", n)
+	}
+	for range results {
+	}
+}
+
+func TestSubmitStreamClosed(t *testing.T) {
+	fmt.Println(t.Name())
+	pool := NewPool(1)
+	pool.Close()
+	var started int32
+	for res := range pool.(StreamSubmitter).SubmitStream(context.Background(), streamTasks(3, &started)) {
+		if res.Err != ErrPoolClosed {
+			t.Error("tasks of stream should fail with ErrPoolClosed after pool closed")
+		}
+	}
+}
+
+func TestSubmitStreamCloseRunning(t *testing.T) {
+	fmt.Println(t.Name())
+	pool := NewPool(1)
+	release := make(chan struct{})
+	tasks := make(chan Task, 1)
+	tasks <- func() (interface{}, error) {
+		<-release
+		return nil, nil
+	}
+	results := pool.(StreamSubmitter).SubmitStreamOrdered(context.Background(), tasks, 1)
+	time.Sleep(10 * time.Millisecond)
+	go pool.Close()
+	select {
+	case res := <-results:
+		if res.Err != ErrPoolClosed {
+			t.Error("result of stream should be ErrPoolClosed after pool closed")
+		}
+	case <-time.After(time.Second):
+		t.Error("stream should not wait for tasks after pool closed")
+	}
+	close(release)
+	close(tasks)
+}
+
+func TestSubmitStreamContext(t *testing.T) {
+	fmt.Println(t.Name())
+	pool := NewPool(2)
+	defer pool.Close()
+	streams := pool.(StreamSubmitter)
+
+	// tasks are never closed, streams quit once ctx done even if results
+	// are not consumed.
+	for _, ordered := range []bool{false, true} {
+		ctx, cancel := context.WithCancel(context.Background())
+		tasks := make(chan Task)
+		go func() {
+			for {
+				select {
+				case tasks <- foo:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+		var results <-chan Result
+		if ordered {
+			results = streams.SubmitStreamOrdered(ctx, tasks, 2)
+		} else {
+			results = streams.SubmitStream(ctx, tasks)
+		}
+		<-results
+		cancel()
+		time.Sleep(20 * time.Millisecond)
+		done := make(chan struct{})
+		go func() {
+			for range results {
+			}
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Errorf("stream should be closed once ctx done, ordered: %v", ordered)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package pond
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// fixedLimit is a LimitAlgorithm whose limit is only changed by set.
+type fixedLimit struct {
+	limit int64
+}
+
+func (l *fixedLimit) Limit() int {
+	return int(atomic.LoadInt64(&l.limit))
+}
+
+func (l *fixedLimit) Update(time.Duration, int, bool) int {
+	return l.Limit()
+}
+
+func (l *fixedLimit) set(limit int) {
+	atomic.StoreInt64(&l.limit, int64(limit))
+}
+
+// SubPool is a pool running tasks on workers of its parent, with its own
+// task queue and concurrency cap, see SubPooler.
+type SubPool interface {
+	ManagedPool
+
+	// Submit is the main entry for submitting new tasks.
+	Submit(task Task) (Future, error)
+
+	// SubmitWithTimeout submit a new task and set expiration.
+	SubmitWithTimeout(task Task, timeout time.Duration) (Future, error)
+}
+
+// SubPooler is implemented by pools sharing their workers with sub-pools.
+type SubPooler interface {
+	// SubPool return a pool with its own queue and concurrency cap, which
+	// runs tasks on workers of this pool.
+	SubPool(name string, maxConcurrency, queueSize int) (SubPool, error)
+}
+
+// subPool expose methods of SubPool only, so that features of parent, e.g.
+// tenants, are not reachable from sub-pools by type assertions.
+type subPool struct {
+	bp *basicPool
+}
+
+func (p subPool) Submit(task Task) (Future, error) {
+	return p.bp.Submit(task)
+}
+
+func (p subPool) SubmitWithTimeout(task Task, timeout time.Duration) (Future, error) {
+	return p.bp.SubmitWithTimeout(task, timeout)
+}
+
+func (p subPool) SetCapacity(newCap int) {
+	p.bp.SetCapacity(newCap)
+}
+
+func (p subPool) Capacity() int {
+	return p.bp.Capacity()
+}
+
+func (p subPool) Workers() int {
+	return p.bp.Workers()
+}
+
+func (p subPool) SetPurgeDuration(dur time.Duration) {
+	p.bp.SetPurgeDuration(dur)
+}
+
+func (p subPool) Pause() {
+	p.bp.Pause()
+}
+
+func (p subPool) Resume() {
+	p.bp.Resume()
+}
+
+func (p subPool) Close() {
+	p.bp.Close()
+}
+
+func (p subPool) State() PoolState {
+	return p.bp.State()
+}
+
+func (p subPool) RunningTasks() []RunningTask {
+	return p.bp.RunningTasks()
+}
+
+// SubPool return a pool running tasks on workers of bp, with its own task
+// queue of queueSize, and at most maxConcurrency tasks running at the same
+// time. Sub-pool can be paused, resumed and closed independently, its
+// capacity is the concurrency cap, and it is closed when bp closed. Pausing
+// bp pauses its sub-pools too.
+func (bp *basicPool) SubPool(name string, maxConcurrency, queueSize int) (SubPool, error) {
+	limit := &fixedLimit{}
+	limit.set(maxConcurrency)
+	sub := &basicPool{
+		name:          name,
+		parent:        bp,
+		capacity:      maxConcurrency,
+		taskQ:         make(chan *TaskEnvelope, queueSize),
+		pause:         make(chan struct{}, 1), // make pause buffered
+		close:         make(chan struct{}),
+		purgeDuration: defaultPurgeWorkersDuration,
+		purgeTicker:   time.NewTicker(defaultPurgeWorkersDuration),
+		subLimit:      limit,
+	}
+	sub.permits = newAdaptiveLimiter(limit, systemClock{}, sub.close)
+	sub.stats.tasks.enabled = bp.stats.tasks.enabled
+
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	select {
+	case <-bp.close:
+		sub.purgeTicker.Stop()
+		return nil, ErrPoolClosed
+	default:
+	}
+	if _, ok := bp.children[name]; ok {
+		sub.purgeTicker.Stop()
+		return nil, ErrSubPoolExists
+	}
+	if bp.children == nil {
+		bp.children = make(map[string]*basicPool)
+	}
+	bp.children[name] = sub
+	go sub.forwardToParent()
+	return subPool{bp: sub}, nil
+}
+
+// forwardToParent forward tasks of sub-pool to its parent once a permit
+// of concurrency acquired, it stops forwarding while sub-pool or parent
+// paused.
+func (bp *basicPool) forwardToParent() {
+	for {
+		select {
+		case <-bp.close:
+			return
+		case te := <-bp.taskQ:
+			inflight, ok := bp.permits.acquire()
+			if !ok {
+				te.drop(ErrPoolClosed)
+				return
+			}
+			inner := te.t
+			te.t = func() (interface{}, error) {
+				defer bp.permits.release(0, inflight, false)
+				return inner()
+			}
+			te.onDrop(func() {
+				bp.permits.release(0, inflight, false)
+			})
+			// check pause after permit acquired, which may take long.
+			if !bp.waitResumed() || !bp.parent.dispatch(te) {
+				te.drop(ErrPoolClosed)
+				return
+			}
+		}
+	}
+}
+
+// closeSubPool close sub-pool without touching workers of parent.
+func (bp *basicPool) closeSubPool() {
+	close(bp.close)
+
+	bp.parent.mu.Lock()
+	if bp.parent.children[bp.name] == bp {
+		delete(bp.parent.children, bp.name)
+	}
+	bp.parent.mu.Unlock()
+
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	close(bp.pause)
+	bp.purgeTicker.Stop()
+	// no more senders enter after locked, tasks left in queue are
+	// reported after those in flight sent.
+	bp.senders.Wait()
+	dropQueue(bp.taskQ)
+}
+
+// subPools return sub-pools of bp.
+func (bp *basicPool) subPools() []*basicPool {
+	bp.mu.RLock()
+	defer bp.mu.RUnlock()
+	subs := make([]*basicPool, 0, len(bp.children))
+	for _, sub := range bp.children {
+		subs = append(subs, sub)
+	}
+	return subs
+}
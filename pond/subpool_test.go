@@ -0,0 +1,122 @@
+package pond
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSubPoolConcurrency(t *testing.T) {
+	fmt.Println(t.Name())
+	pool := NewPoolWithOptions(WithCapacity(4))
+	sub, err := pool.(SubPooler).SubPool("a", 1, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pool.(SubPooler).SubPool("a", 1, 16); err != ErrSubPoolExists {
+		t.Error("sub-pool name should be unique")
+	}
+
+	var running, peak int32
+	var futures []Future
+	for i := 0; i < 4; i++ {
+		future, _ := sub.Submit(func() (interface{}, error) {
+			n := atomic.AddInt32(&running, 1)
+			if n > atomic.LoadInt32(&peak) {
+				atomic.StoreInt32(&peak, n)
+			}
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			return nil, nil
+		})
+		futures = append(futures, future)
+	}
+	for _, future := range futures {
+		_, _ = future.Value()
+	}
+	if atomic.LoadInt32(&peak) != 1 || sub.Workers() != 1 {
+		t.Errorf("running tasks should not exceed concurrency of sub-pool, got %d", peak)
+	}
+	stats := pool.(StatsReporter).Stats()
+	if stats.SubPools["a"].Completed != 4 || stats.Completed != 4 {
+		t.Errorf("parent stats should break down by sub-pool, got %+v", stats)
+	}
+	sub.SetCapacity(2)
+	if sub.Workers() != 2 {
+		t.Error("capacity of sub-pool should be its concurrency cap")
+	}
+	pool.Close()
+	if _, err := sub.Submit(foo); err != ErrPoolClosed {
+		t.Error("sub-pool should be closed with parent")
+	}
+}
+
+func TestSubPoolIsolation(t *testing.T) {
+	fmt.Println(t.Name())
+	pool := NewPoolWithOptions(WithCapacity(2))
+	a, _ := pool.(SubPooler).SubPool("a", 1, 16)
+	b, _ := pool.(SubPooler).SubPool("b", 1, 16)
+
+	a.Pause()
+	if _, err := a.Submit(foo); err != ErrPoolPaused {
+		t.Error("sub-pool has paused, no more tasks submitted!")
+	}
+	future, _ := b.Submit(foo)
+	if _, err := future.Value(); err != nil {
+		t.Error("sibling should not be affected by pausing sub-pool")
+	}
+	a.Resume()
+
+	release := make(chan struct{})
+	_, _ = a.Submit(func() (interface{}, error) {
+		<-release
+		return nil, nil
+	})
+	queued, _ := a.Submit(foo)
+	a.Close()
+	close(release)
+	if _, err := queued.Value(); err != ErrPoolClosed {
+		t.Error("queued task should fail when sub-pool closed")
+	}
+	future, _ = b.Submit(foo)
+	if _, err := future.Value(); err != nil {
+		t.Error("sibling should not be affected by closing sub-pool")
+	}
+	if _, ok := pool.(StatsReporter).Stats().SubPools["a"]; ok {
+		t.Error("closed sub-pool should be removed from parent")
+	}
+	pool.Close()
+}
+
+func TestSubPoolParentPaused(t *testing.T) {
+	fmt.Println(t.Name())
+	pool := NewPoolWithOptions(WithCapacity(1))
+	sub, _ := pool.(SubPooler).SubPool("a", 1, 16)
+	if _, ok := sub.(TenantScheduler); ok {
+		t.Error("features of parent should not be reachable from sub-pool")
+	}
+
+	started, release := make(chan struct{}), make(chan struct{})
+	_, _ = sub.Submit(func() (interface{}, error) {
+		close(started)
+		<-release
+		return nil, nil
+	})
+	<-started
+	queued, _ := sub.Submit(foo)
+	pool.Pause()
+	if _, err := sub.Submit(foo); err != ErrPoolPaused {
+		t.Error("sub-pool should reject tasks while parent paused")
+	}
+	close(release)
+	time.Sleep(20 * time.Millisecond)
+	if pool.(StatsReporter).Stats().SubPools["a"].Completed != 1 {
+		t.Error("queued task of sub-pool should not run while parent paused")
+	}
+	pool.Resume()
+	if _, err := queued.Value(); err != nil {
+		t.Error("queued task of sub-pool should run after parent resumed:", err)
+	}
+	pool.Close()
+}
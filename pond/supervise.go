@@ -0,0 +1,320 @@
+package pond
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TaskSupervisor is implemented by pools running long-running tasks on
+// reserved workers.
+type TaskSupervisor interface {
+	// Supervise run a long-running task on a reserved worker and restart
+	// it on failure.
+	Supervise(spec SupervisorSpec) (*Supervisor, error)
+}
+
+// SupervisorSpec describe a long-running task supervised by pool, see
+// TaskSupervisor. It is restarted one-for-one, only itself is restarted
+// when it failed.
+type SupervisorSpec struct {
+	Name string
+
+	// Run is the long-running loop, it should return nil once stop
+	// closed. Returning an error or panicking restarts it, returning nil
+	// before stop closed finishes supervision. It must not be nil.
+	Run func(stop <-chan struct{}) error
+
+	// MaxRestarts limit the number of restarts within Window, supervision
+	// gives up once exceeded. Non-positive MaxRestarts means unlimited,
+	// zero Window means restarts are counted over lifetime.
+	MaxRestarts int
+	Window      time.Duration
+
+	// Backoff is the delay ahead of the first restart, it doubles for
+	// every further restart in Window until MaxBackoff. They are
+	// defaultSupervisorBackoff and defaultSupervisorMaxBackoff if not
+	// positive.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// SupervisorState is the state of supervised task.
+type SupervisorState int32
+
+const (
+	// SupervisorRunning is running the task.
+	SupervisorRunning SupervisorState = iota
+	// SupervisorBackoff wait for restarting the failed task.
+	SupervisorBackoff
+	// SupervisorStopped is stopped or finished.
+	SupervisorStopped
+	// SupervisorFailed gave up restarting.
+	SupervisorFailed
+)
+
+func (s SupervisorState) String() string {
+	switch s {
+	case SupervisorRunning:
+		return "running"
+	case SupervisorBackoff:
+		return "backoff"
+	case SupervisorStopped:
+		return "stopped"
+	case SupervisorFailed:
+		return "failed"
+	}
+	return "unknown"
+}
+
+// SupervisorEventType is the type of SupervisorEvent.
+type SupervisorEventType int32
+
+const (
+	// EventRestarting is emitted when task failed and going to restart
+	// after Delay.
+	EventRestarting SupervisorEventType = iota
+	// EventGaveUp is emitted when task failed and restarts exceeded.
+	EventGaveUp
+	// EventStopped is emitted when task stopped or finished.
+	EventStopped
+)
+
+// SupervisorEvent report a change of supervised task.
+type SupervisorEvent struct {
+	Type     SupervisorEventType
+	Name     string
+	Restarts int
+	Err      error
+	Delay    time.Duration
+	Time     time.Time
+}
+
+// SupervisorStatus is a snapshot of supervised task.
+type SupervisorStatus struct {
+	State    SupervisorState
+	Restarts int
+	LastErr  error
+}
+
+// Supervisor is the handle of a supervised task.
+type Supervisor struct {
+	spec SupervisorSpec
+	pool *basicPool
+	// taskQ feeds runs of task to the reserved worker only.
+	taskQ chan *TaskEnvelope
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+	events   chan SupervisorEvent
+
+	mu     sync.Mutex
+	status SupervisorStatus
+}
+
+// Supervise run spec.Run on a reserved worker outside the task queue, and
+// restart it on failure, see SupervisorSpec. The worker is constructed and
+// initialized like other workers of pool, and every run passes through
+// middlewares and hook of pool. Runs hold no workers of pool, so they are
+// not counted as running tasks in Stats. It is stopped once pool closed,
+// and Close waits for it.
+func (bp *basicPool) Supervise(spec SupervisorSpec) (*Supervisor, error) {
+	if spec.Run == nil {
+		return nil, ErrSupervisorSpec
+	}
+	if spec.Backoff <= 0 {
+		spec.Backoff = defaultSupervisorBackoff
+	}
+	if spec.MaxBackoff <= 0 {
+		spec.MaxBackoff = defaultSupervisorMaxBackoff
+	}
+
+	// lock against Close, so that supervisors are all counted ahead of
+	// waiting for them.
+	bp.mu.RLock()
+	defer bp.mu.RUnlock()
+	select {
+	case <-bp.close:
+		return nil, ErrPoolClosed
+	default:
+	}
+
+	s := &Supervisor{
+		spec:   spec,
+		pool:   bp,
+		taskQ:  make(chan *TaskEnvelope, 1),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+		events: make(chan SupervisorEvent, defaultSupervisorEvents),
+	}
+	w := bp.workerCtor(s.taskQ)
+	initErr := make(chan error, 1)
+	go bp.runWorker(w, initErr)
+	if err := <-initErr; err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWorkerInit, err)
+	}
+
+	atomic.AddInt64(&bp.stats.supervised, 1)
+	bp.supervisors.Add(1)
+	go func() {
+		defer bp.supervisors.Done()
+		defer atomic.AddInt64(&bp.stats.supervised, -1)
+		defer w.Close()
+		s.supervise()
+	}()
+	go func() {
+		select {
+		case <-bp.close:
+			s.signal()
+		case <-s.done:
+		}
+	}()
+	return s, nil
+}
+
+func (s *Supervisor) supervise() {
+	defer close(s.done)
+	defer close(s.events)
+
+	var restarts []time.Time
+	for {
+		s.setStatus(SupervisorRunning, nil)
+		err := s.runOnce()
+		if err == nil || s.stopped() {
+			s.setStatus(SupervisorStopped, err)
+			s.emit(SupervisorEvent{Type: EventStopped, Err: err})
+			return
+		}
+
+		now := time.Now()
+		if s.spec.Window > 0 {
+			alive := restarts[:0]
+			for _, at := range restarts {
+				if now.Sub(at) < s.spec.Window {
+					alive = append(alive, at)
+				}
+			}
+			restarts = alive
+		}
+		if s.spec.MaxRestarts > 0 && len(restarts) >= s.spec.MaxRestarts {
+			s.setStatus(SupervisorFailed, err)
+			s.emit(SupervisorEvent{Type: EventGaveUp, Err: err})
+			return
+		}
+		restarts = append(restarts, now)
+
+		delay := s.backoff(len(restarts))
+		s.mu.Lock()
+		s.status.Restarts++
+		s.mu.Unlock()
+		s.setStatus(SupervisorBackoff, err)
+		s.emit(SupervisorEvent{Type: EventRestarting, Err: err, Delay: delay})
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-s.stop:
+			timer.Stop()
+			s.setStatus(SupervisorStopped, err)
+			s.emit(SupervisorEvent{Type: EventStopped, Err: err})
+			return
+		}
+	}
+}
+
+// runOnce run the task on the reserved worker and wait for it done, its
+// panic is turned into error.
+func (s *Supervisor) runOnce() error {
+	te := rscPool.GetTask(func(interface{}) (_ interface{}, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("%w: %v", ErrTaskPanicked, r)
+			}
+		}()
+		return nil, s.spec.Run(s.stop)
+	}, make(chan *taskResult, 1))
+	// not tracked by stats, running tasks occupy workers of pool.
+	te.t = chain(te.t, s.pool.middlewares)
+	if s.pool.hook != nil {
+		te.t = hooked(s.pool.hook, nil, te.t)
+	}
+	s.taskQ <- te
+	res := <-te.resChan
+	err := res.err
+	rscPool.PutTaskResult(res)
+	return err
+}
+
+// backoff return the delay ahead of the nth restart in window.
+func (s *Supervisor) backoff(n int) time.Duration {
+	delay := s.spec.Backoff
+	for i := 1; i < n && delay > 0; i++ {
+		delay *= 2
+		if s.spec.MaxBackoff > 0 && delay >= s.spec.MaxBackoff {
+			return s.spec.MaxBackoff
+		}
+	}
+	if s.spec.MaxBackoff > 0 && delay > s.spec.MaxBackoff {
+		return s.spec.MaxBackoff
+	}
+	return delay
+}
+
+func (s *Supervisor) stopped() bool {
+	select {
+	case <-s.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *Supervisor) signal() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+}
+
+func (s *Supervisor) setStatus(state SupervisorState, err error) {
+	s.mu.Lock()
+	s.status.State, s.status.LastErr = state, err
+	s.mu.Unlock()
+}
+
+// emit send event without blocking, it is dropped if events are not
+// consumed in time.
+func (s *Supervisor) emit(e SupervisorEvent) {
+	s.mu.Lock()
+	e.Name, e.Restarts, e.Time = s.spec.Name, s.status.Restarts, time.Now()
+	s.mu.Unlock()
+	select {
+	case s.events <- e:
+	default:
+	}
+}
+
+// Stop signal the task to stop and wait for it returned.
+func (s *Supervisor) Stop() {
+	s.signal()
+	<-s.done
+}
+
+// Status return a snapshot of supervised task.
+func (s *Supervisor) Status() SupervisorStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+// Events return the channel of events, it is closed after supervision
+// ended. Events are dropped if not consumed in time.
+func (s *Supervisor) Events() <-chan SupervisorEvent {
+	return s.events
+}
+
+// Done return a channel closed after supervision ended.
+func (s *Supervisor) Done() <-chan struct{} {
+	return s.done
+}
@@ -0,0 +1,206 @@
+package pond
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSupervise(t *testing.T) {
+	fmt.Println(t.Name())
+	pool := NewPool(1)
+	defer pool.Close()
+
+	var runs int32
+	sup, err := pool.(TaskSupervisor).Supervise(SupervisorSpec{
+		Name: "consumer",
+		Run: func(stop <-chan struct{}) error {
+			switch atomic.AddInt32(&runs, 1) {
+			case 1:
+				return errors.New("connection lost")
+			case 2:
+				panic("boom")
+			}
+			<-stop
+			return nil
+		},
+		Backoff: time.Millisecond,
+	})
+	if err != nil {
+		t.Error("task should be supervised:", err)
+		return
+	}
+
+	for i := 0; i < 2; i++ {
+		e := <-sup.Events()
+		if e.Type != EventRestarting || e.Name != "consumer" || e.Restarts != i+1 {
+			t.Errorf("failed task should be restarted, got %+v", e)
+		}
+		if i == 1 && !errors.Is(e.Err, ErrTaskPanicked) {
+			t.Errorf("panic should be turned into error, got %v", e.Err)
+		}
+	}
+	for sup.Status().State != SupervisorRunning {
+		time.Sleep(time.Millisecond)
+	}
+	if restarts := sup.Status().Restarts; restarts != 2 {
+		t.Errorf("restarts should be counted, got %d", restarts)
+	}
+	if supervised := pool.(StatsReporter).Stats().Supervised; supervised != 1 {
+		t.Errorf("supervised tasks should be counted, got %d", supervised)
+	}
+
+	// reserved worker does not hold the only worker of pool.
+	future, _ := pool.Submit(func() (interface{}, error) { return 1, nil })
+	if val, _ := future.Value(); val != 1 {
+		t.Errorf("task should run beside supervised task, got %v", val)
+	}
+	if running := pool.(StatsReporter).Stats().Running; running != 0 {
+		t.Errorf("supervised task should not be counted as running, got %d", running)
+	}
+	future, _ = pool.(TenantScheduler).SubmitForTenant("a", func() (interface{}, error) { return 2, nil })
+	if val, _ := future.Value(); val != 2 {
+		t.Errorf("task of tenant should run beside supervised task, got %v", val)
+	}
+
+	sup.Stop()
+	if e := <-sup.Events(); e.Type != EventStopped {
+		t.Errorf("stopped event should be emitted, got %+v", e)
+	}
+	if _, ok := <-sup.Events(); ok {
+		t.Error("events should be closed after stopped")
+	}
+	if state := sup.Status().State; state != SupervisorStopped {
+		t.Errorf("supervisor should be stopped, got %v", state)
+	}
+}
+
+func TestSuperviseWorker(t *testing.T) {
+	fmt.Println(t.Name())
+	var inits, wrapped int32
+	pool := NewPoolWithOptions(WithCapacity(1),
+		WithWorkerState(func() (interface{}, error) {
+			atomic.AddInt32(&inits, 1)
+			return nil, nil
+		}, nil),
+		WithMiddleware(func(next Task) Task {
+			return func() (interface{}, error) {
+				atomic.AddInt32(&wrapped, 1)
+				return next()
+			}
+		}))
+	defer pool.Close()
+
+	sup, _ := pool.(TaskSupervisor).Supervise(SupervisorSpec{
+		Run:         func(<-chan struct{}) error { return errors.New("fatal") },
+		MaxRestarts: 1,
+		Backoff:     time.Millisecond,
+	})
+	<-sup.Done()
+	if n := atomic.LoadInt32(&inits); n != 2 {
+		t.Errorf("reserved worker should be initialized like other workers, got %d inits", n)
+	}
+	if n := atomic.LoadInt32(&wrapped); n != 2 {
+		t.Errorf("every run should pass through middlewares, got %d", n)
+	}
+
+	errInit := errors.New("init")
+	pool = NewPoolWithOptions(WithCapacity(1), WithWorkerState(func() (interface{}, error) {
+		return nil, errInit
+	}, nil))
+	defer pool.Close()
+	if _, err := pool.(TaskSupervisor).Supervise(SupervisorSpec{Run: func(<-chan struct{}) error { return nil }}); !errors.Is(err, ErrWorkerInit) {
+		t.Errorf("initialization failure of reserved worker should be returned, got %v", err)
+	}
+}
+
+func TestSuperviseGiveUp(t *testing.T) {
+	fmt.Println(t.Name())
+	pool := NewPool(1)
+	defer pool.Close()
+
+	errFatal := errors.New("fatal")
+	sup, _ := pool.(TaskSupervisor).Supervise(SupervisorSpec{
+		Run:         func(<-chan struct{}) error { return errFatal },
+		MaxRestarts: 3,
+		Window:      time.Minute,
+		Backoff:     time.Millisecond,
+	})
+	<-sup.Done()
+	if status := sup.Status(); status.State != SupervisorFailed || status.Restarts != 3 || status.LastErr != errFatal {
+		t.Errorf("supervisor should give up after max restarts, got %+v", status)
+	}
+	var last SupervisorEvent
+	for e := range sup.Events() {
+		last = e
+	}
+	if last.Type != EventGaveUp {
+		t.Errorf("gave up event should be emitted, got %+v", last)
+	}
+}
+
+func TestSupervisePoolClose(t *testing.T) {
+	fmt.Println(t.Name())
+	pool := NewPool(1)
+	var stopped int32
+	sup, _ := pool.(TaskSupervisor).Supervise(SupervisorSpec{
+		Run: func(stop <-chan struct{}) error {
+			<-stop
+			// supervised task can inspect pool while stopping.
+			_ = pool.Workers()
+			time.Sleep(10 * time.Millisecond)
+			atomic.StoreInt32(&stopped, 1)
+			return nil
+		},
+	})
+	closed := make(chan struct{})
+	go func() {
+		pool.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Error("closing pool should not block on supervised task inspecting pool")
+		return
+	}
+	if atomic.LoadInt32(&stopped) != 1 {
+		t.Error("closing pool should wait for supervised task")
+	}
+	select {
+	case <-sup.Done():
+	case <-time.After(time.Second):
+		t.Error("supervised task should be stopped by pool close")
+	}
+	if _, err := pool.(TaskSupervisor).Supervise(SupervisorSpec{Run: func(<-chan struct{}) error { return nil }}); err != ErrPoolClosed {
+		t.Error("task should not be supervised after pool closed")
+	}
+}
+
+func TestSuperviseSpec(t *testing.T) {
+	fmt.Println(t.Name())
+	pool := NewPool(1)
+	defer pool.Close()
+	if _, err := pool.(TaskSupervisor).Supervise(SupervisorSpec{Name: "nil"}); err != ErrSupervisorSpec {
+		t.Error("spec without run func should be rejected")
+	}
+
+	s := &Supervisor{spec: SupervisorSpec{Backoff: time.Second, MaxBackoff: 5 * time.Second}}
+	for i, expect := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		if delay := s.backoff(i + 1); delay != expect {
+			t.Errorf("backoff of restart %d should be %v, got %v", i+1, expect, delay)
+		}
+	}
+
+	sup, _ := pool.(TaskSupervisor).Supervise(SupervisorSpec{Run: func(<-chan struct{}) error { return errors.New("fatal") }})
+	e := <-sup.Events()
+	if e.Type != EventRestarting || e.Delay != defaultSupervisorBackoff {
+		t.Errorf("restart should be delayed by default backoff, got %+v", e)
+	}
+	sup.Stop()
+	if sup.spec.MaxBackoff != defaultSupervisorMaxBackoff {
+		t.Errorf("max backoff should be defaulted, got %v", sup.spec.MaxBackoff)
+	}
+}
@@ -0,0 +1,253 @@
+package pond
+
+import (
+	"container/list"
+	"sort"
+	"sync"
+	"time"
+)
+
+// TaskTracker is implemented by pools tracking tasks by IDs, see
+// WithTaskRegistry.
+type TaskTracker interface {
+	// Status return the status of task by ID.
+	Status(id string) (TaskInfo, bool)
+
+	// Cancel cancel a queued task by ID.
+	Cancel(id string) error
+
+	// List return tracked tasks accepted by filter.
+	List(filter func(TaskInfo) bool) []TaskInfo
+}
+
+// TaskStatus is the status of task tracked by task registry.
+type TaskStatus int32
+
+const (
+	// TaskQueued wait for workers.
+	TaskQueued TaskStatus = iota
+	// TaskRunning is under execution.
+	TaskRunning
+	// TaskDone done without error.
+	TaskDone
+	// TaskFailed done with error.
+	TaskFailed
+	// TaskCancelled is cancelled before execution.
+	TaskCancelled
+)
+
+func (s TaskStatus) String() string {
+	switch s {
+	case TaskQueued:
+		return "queued"
+	case TaskRunning:
+		return "running"
+	case TaskDone:
+		return "done"
+	case TaskFailed:
+		return "failed"
+	case TaskCancelled:
+		return "cancelled"
+	}
+	return "unknown"
+}
+
+// TaskInfo describe a task tracked by task registry, timestamps are zero
+// until task reaches the status.
+type TaskInfo struct {
+	ID     string
+	Name   string
+	Labels map[string]string
+	Status TaskStatus
+	Err    error
+
+	Submitted time.Time
+	Started   time.Time
+	Finished  time.Time
+}
+
+// finished report whether task reaches final status.
+func (info *TaskInfo) finished() bool {
+	return info.Status >= TaskDone
+}
+
+// taskRegistry track tasks submitted to pool by ID, at most retention
+// finished tasks are kept, the oldest ones are evicted first.
+type taskRegistry struct {
+	mu        sync.Mutex
+	tasks     map[string]*taskEntry
+	finished  *list.List
+	retention int
+}
+
+// taskEntry hold envelope of task until finished, so that it can be
+// cancelled.
+type taskEntry struct {
+	TaskInfo
+	te *TaskEnvelope
+}
+
+func newTaskRegistry(retention int) *taskRegistry {
+	return &taskRegistry{
+		tasks:     make(map[string]*taskEntry),
+		finished:  list.New(),
+		retention: retention,
+	}
+}
+
+// add register a queued task of te, ErrTaskExists returned if its ID is
+// taken.
+func (r *taskRegistry) add(te *TaskEnvelope) error {
+	meta := te.meta
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.tasks[meta.ID]; ok {
+		return ErrTaskExists
+	}
+	r.tasks[meta.ID] = &taskEntry{
+		TaskInfo: TaskInfo{
+			ID:        meta.ID,
+			Name:      meta.Name,
+			Labels:    meta.Labels,
+			Status:    TaskQueued,
+			Submitted: time.Now(),
+		},
+		te: te,
+	}
+	return nil
+}
+
+// remove unregister task failed to be submitted.
+func (r *taskRegistry) remove(id string) {
+	r.mu.Lock()
+	delete(r.tasks, id)
+	r.mu.Unlock()
+}
+
+// start mark task running, return false if it was cancelled. Tasks not
+// registered are always started.
+func (r *taskRegistry) start(id string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	info, ok := r.tasks[id]
+	if !ok {
+		return true
+	}
+	if info.Status == TaskCancelled {
+		return false
+	}
+	info.Status, info.Started = TaskRunning, time.Now()
+	return true
+}
+
+// finish mark task done or failed by err.
+func (r *taskRegistry) finish(id string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	info, ok := r.tasks[id]
+	if !ok {
+		return
+	}
+	info.Status, info.Err = TaskDone, err
+	if err != nil {
+		info.Status = TaskFailed
+	}
+	r.retire(info)
+}
+
+// retire keep finished task in retention window, caller should hold lock.
+func (r *taskRegistry) retire(info *taskEntry) {
+	info.Finished, info.te = time.Now(), nil
+	r.finished.PushBack(info.ID)
+	for r.finished.Len() > r.retention {
+		delete(r.tasks, r.finished.Remove(r.finished.Front()).(string))
+	}
+}
+
+func (r *taskRegistry) cancel(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	info, ok := r.tasks[id]
+	switch {
+	case !ok:
+		return ErrTaskNotFound
+	case info.Status == TaskRunning:
+		return ErrTaskRunning
+	case info.finished():
+		return ErrTaskFinished
+	}
+	// task may be dropped by closing pool meanwhile.
+	if !info.te.cancel() {
+		return ErrTaskFinished
+	}
+	info.Status, info.Err = TaskCancelled, ErrTaskCancelled
+	r.retire(info)
+	return nil
+}
+
+func (r *taskRegistry) status(id string) (TaskInfo, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	info, ok := r.tasks[id]
+	if !ok {
+		return TaskInfo{}, false
+	}
+	return info.TaskInfo, true
+}
+
+func (r *taskRegistry) list(filter func(TaskInfo) bool) []TaskInfo {
+	r.mu.Lock()
+	infos := make([]TaskInfo, 0, len(r.tasks))
+	for _, info := range r.tasks {
+		if filter == nil || filter(info.TaskInfo) {
+			infos = append(infos, info.TaskInfo)
+		}
+	}
+	r.mu.Unlock()
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Submitted.Before(infos[j].Submitted)
+	})
+	return infos
+}
+
+// track skip task cancelled while queued and record its final status,
+// it wraps all other behaviors of pool.
+func (r *taskRegistry) track(id string, next Task) Task {
+	return func() (interface{}, error) {
+		if !r.start(id) {
+			return nil, ErrTaskCancelled
+		}
+		val, err := next()
+		r.finish(id, err)
+		return val, err
+	}
+}
+
+// Status return the status of task by ID, ok is false if task is not
+// tracked, see WithTaskRegistry.
+func (bp *basicPool) Status(id string) (info TaskInfo, ok bool) {
+	if bp.tasks == nil {
+		return TaskInfo{}, false
+	}
+	return bp.tasks.status(id)
+}
+
+// Cancel cancel a queued task by ID, its Future gets ErrTaskCancelled at
+// once, and the task is skipped by workers. Running tasks can not be
+// interrupted, ErrTaskRunning returned for them.
+func (bp *basicPool) Cancel(id string) error {
+	if bp.tasks == nil {
+		return ErrTaskNotFound
+	}
+	return bp.tasks.cancel(id)
+}
+
+// List return tracked tasks accepted by filter in order of submission,
+// nil filter accepts all.
+func (bp *basicPool) List(filter func(TaskInfo) bool) []TaskInfo {
+	if bp.tasks == nil {
+		return nil
+	}
+	return bp.tasks.list(filter)
+}
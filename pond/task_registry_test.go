@@ -0,0 +1,138 @@
+package pond
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestTaskRegistry(t *testing.T) {
+	fmt.Println(t.Name())
+	pool := NewPoolWithOptions(WithCapacity(1), WithTaskRegistry(2))
+	defer pool.Close()
+	tracker := pool.(TaskTracker)
+
+	release, started := make(chan struct{}), make(chan struct{})
+	running, _ := pool.(MetadataSubmitter).SubmitWithOptions(func() (interface{}, error) {
+		close(started)
+		<-release
+		return nil, nil
+	}, TaskOptions{Name: "long", ID: "job-1"})
+	<-started
+
+	queued, err := pool.Submit(func() (interface{}, error) { return 1, nil })
+	if err != nil {
+		t.Error("task should be submitted:", err)
+		return
+	}
+	id := queued.(IdentifiedFuture).ID()
+	if id == "" {
+		t.Error("ID of tracked task should be generated")
+	}
+	if _, err := pool.(MetadataSubmitter).SubmitWithOptions(foo, TaskOptions{ID: "job-1"}); err != ErrTaskExists {
+		t.Error("ID of tracked task should not be taken again")
+	}
+
+	if info, ok := tracker.Status("job-1"); !ok || info.Status != TaskRunning || info.Name != "long" || info.Started.IsZero() {
+		t.Errorf("running task should be tracked, got %+v", info)
+	}
+	if info, _ := tracker.Status(id); info.Status != TaskQueued {
+		t.Errorf("queued task should be tracked, got %v", info.Status)
+	}
+	if err := tracker.Cancel("job-1"); err != ErrTaskRunning {
+		t.Error("running task should not be cancelled")
+	}
+	if err := tracker.Cancel("job-x"); err != ErrTaskNotFound {
+		t.Error("task not tracked should not be found")
+	}
+	if err := tracker.Cancel(id); err != nil {
+		t.Error("queued task should be cancelled:", err)
+	}
+	if err := tracker.Cancel(id); err != ErrTaskFinished {
+		t.Error("cancelled task should not be cancelled again")
+	}
+	// Future of cancelled task is resolved while worker still busy.
+	if _, err := queued.Value(); err != ErrTaskCancelled {
+		t.Error("cancelled task should fail with ErrTaskCancelled")
+	}
+
+	close(release)
+	_, _ = running.Value()
+	if info, _ := tracker.Status("job-1"); info.Status != TaskDone || info.Finished.IsZero() {
+		t.Errorf("done task should be tracked, got %+v", info)
+	}
+	// cancelled task is skipped by worker.
+	future, _ := pool.Submit(foo)
+	_, _ = future.Value()
+	if completed := pool.(StatsReporter).Stats().Completed; completed != 2 {
+		t.Errorf("cancelled task should not be executed, got %d completed", completed)
+	}
+
+	infos := tracker.List(func(info TaskInfo) bool { return info.Status != TaskCancelled })
+	if len(infos) != 2 || infos[0].ID != "job-1" {
+		t.Errorf("tracked tasks should be listed in order of submission, got %+v", infos)
+	}
+
+	failed, _ := pool.Submit(func() (interface{}, error) { return nil, errors.New("oops") })
+	_, _ = failed.Value()
+	infos = tracker.List(func(info TaskInfo) bool { return info.Status == TaskFailed })
+	if len(infos) != 1 || infos[0].ID != failed.(IdentifiedFuture).ID() || infos[0].Err == nil {
+		t.Errorf("failed task should be listed with its error, got %+v", infos)
+	}
+
+	// retention keeps the latest 2 finished tasks, the cancelled one
+	// finished first.
+	if _, ok := tracker.Status(id); ok {
+		t.Error("oldest finished task should be evicted")
+	}
+	if n := len(tracker.List(nil)); n != 2 {
+		t.Errorf("2 finished tasks should be retained, got %d", n)
+	}
+}
+
+func TestTaskRegistryCancelClose(t *testing.T) {
+	fmt.Println(t.Name())
+	pool := NewPoolWithOptions(WithCapacity(1), WithTaskRegistry(0))
+	release := make(chan struct{})
+	_, _ = pool.Submit(func() (interface{}, error) {
+		<-release
+		return nil, nil
+	})
+	queued, _ := pool.Submit(foo)
+	if err := pool.(TaskTracker).Cancel(queued.(IdentifiedFuture).ID()); err != nil {
+		t.Error("queued task should be cancelled:", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		pool.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("closing pool should not block on cancelled task")
+	}
+	close(release)
+	if _, err := queued.Value(); err != ErrTaskCancelled {
+		t.Error("cancelled task should fail with ErrTaskCancelled")
+	}
+}
+
+func TestTaskRegistryDisabled(t *testing.T) {
+	fmt.Println(t.Name())
+	pool := NewPool(1)
+	defer pool.Close()
+	tracker := pool.(TaskTracker)
+	future, _ := pool.Submit(func() (interface{}, error) { return nil, nil })
+	_, _ = future.Value()
+	if _, ok := tracker.Status(future.(IdentifiedFuture).ID()); ok {
+		t.Error("task should not be tracked unless enabled")
+	}
+	if err := tracker.Cancel("1"); err != ErrTaskNotFound {
+		t.Error("task should not be found unless tracked")
+	}
+	if tracker.List(nil) != nil {
+		t.Error("no tasks should be listed unless tracked")
+	}
+}
@@ -0,0 +1,383 @@
+package pond
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TenantConfig configures how a tenant shares workers of pool with
+// others, see SubmitForTenant.
+type TenantConfig struct {
+	// Weight is the share of workers relative to other tenants, default
+	// is 1.
+	Weight int
+
+	// MaxInFlight caps the number of running tasks of tenant, 0 means
+	// no cap.
+	MaxInFlight int
+
+	// MaxQueue caps the number of queued tasks of tenant, submissions
+	// beyond are rejected with ErrTenantQueueFull. Default is
+	// defaultTaskQueueCapacity.
+	MaxQueue int
+}
+
+// TenantScheduler is implemented by pools scheduling tasks of tenants
+// fairly.
+type TenantScheduler interface {
+	// SubmitForTenant submit a new task on behalf of a tenant, tasks of
+	// tenants are scheduled fairly by weights, see SetTenant.
+	SubmitForTenant(tenantID string, task Task) (Future, error)
+
+	// SetTenant configure weight and limits of a tenant, tenants not
+	// configured get default config and are forgotten after idle for a
+	// while, along with their statistics.
+	SetTenant(tenantID string, cfg TenantConfig)
+
+	// TenantStats return statistics of every tenant.
+	TenantStats() map[string]TenantStats
+}
+
+// TenantStats is a snapshot of statistics of a tenant.
+type TenantStats struct {
+	Submitted uint64
+	Rejected  uint64
+	Completed uint64
+	Failed    uint64
+	Queued    int
+	InFlight  int
+}
+
+type tenant struct {
+	id      string
+	cfg     TenantConfig
+	queue   []*TaskEnvelope
+	deficit int
+	// active reports whether tenant is in the round-robin ring.
+	active   bool
+	inflight int
+	stats    TenantStats
+	// configured tenants are kept forever, others are evicted after idle
+	// for defaultTenantIdleTimeout since last used.
+	configured bool
+	last       time.Time
+}
+
+// fairScheduler schedule tasks of tenants by deficit round-robin: tenants
+// with queued tasks take turns, and every turn a tenant gains Weight
+// credits and dispatches tasks until credits run out, every task costs
+// its cost of rate limit. Tasks are dispatched only when there are idle
+// workers, so that workers pull from the scheduler instead of task queue
+// filled by a noisy tenant. Tasks submitted by other methods occupy
+// workers too, so they are counted against idle workers.
+type fairScheduler struct {
+	bp *basicPool
+
+	mu      sync.Mutex
+	tenants map[string]*tenant
+	ring    []*tenant
+	// closed is set once queued tasks failed, tasks are rejected then.
+	closed bool
+	// wake is signaled when a task queued or done.
+	wake chan struct{}
+}
+
+func newFairScheduler(bp *basicPool) *fairScheduler {
+	return &fairScheduler{
+		bp:      bp,
+		tenants: make(map[string]*tenant),
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// tenant return tenant of id, create it with default config if absent.
+// Caller should hold the lock.
+func (s *fairScheduler) tenant(id string) *tenant {
+	t, ok := s.tenants[id]
+	if !ok {
+		t = &tenant{id: id}
+		t.setConfig(TenantConfig{})
+		s.tenants[id] = t
+	}
+	return t
+}
+
+func (t *tenant) setConfig(cfg TenantConfig) {
+	if cfg.Weight <= 0 {
+		cfg.Weight = 1
+	}
+	if cfg.MaxQueue <= 0 {
+		cfg.MaxQueue = defaultTaskQueueCapacity
+	}
+	t.cfg = cfg
+}
+
+// eligible reports whether tenant can dispatch a task now.
+func (t *tenant) eligible() bool {
+	return len(t.queue) > 0 && (t.cfg.MaxInFlight <= 0 || t.inflight < t.cfg.MaxInFlight)
+}
+
+func (s *fairScheduler) setConfig(id string, cfg TenantConfig) {
+	s.mu.Lock()
+	t := s.tenant(id)
+	t.setConfig(cfg)
+	t.configured = true
+	s.mu.Unlock()
+	s.signal()
+}
+
+func (s *fairScheduler) enqueue(id string, te *TaskEnvelope) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// pool may be closed after checked by submitter.
+	if s.closed {
+		return ErrPoolClosed
+	}
+
+	t := s.tenant(id)
+	if len(t.queue) >= t.cfg.MaxQueue {
+		t.stats.Rejected++
+		return ErrTenantQueueFull
+	}
+	t.stats.Submitted++
+	t.last = time.Now()
+	t.queue = append(t.queue, te)
+	if !t.active {
+		t.active = true
+		s.ring = append(s.ring, t)
+	}
+	s.signal()
+	return nil
+}
+
+func (s *fairScheduler) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// next pop the next task to dispatch by deficit round-robin, it returns
+// nil if no idle workers or no eligible tenants, busy reports the former.
+// Caller should hold the lock.
+func (s *fairScheduler) next() (t *tenant, te *TaskEnvelope, busy bool) {
+	if len(s.ring) == 0 {
+		return nil, nil, false
+	}
+	if s.bp.busyWorkers() >= s.bp.Workers() {
+		return nil, nil, true
+	}
+	// visited counts tenants skipped in a row for MaxInFlight, loop ends
+	// once all tenants skipped.
+	for visited := 0; visited < len(s.ring); {
+		t := s.ring[0]
+		if len(t.queue) == 0 {
+			// leave the ring until new task queued.
+			t.active, t.deficit = false, 0
+			s.ring = s.ring[1:]
+			continue
+		}
+		if !t.eligible() {
+			s.ring = append(s.ring[1:], t)
+			visited++
+			continue
+		}
+		te := t.queue[0]
+		cost := te.cost
+		if cost < 1 {
+			cost = 1
+		}
+		if t.deficit >= cost {
+			t.deficit -= cost
+			t.queue[0] = nil
+			t.queue = t.queue[1:]
+			t.inflight++
+			return t, te, false
+		}
+		// turn ends, move tenant to the back and grant its credits.
+		s.ring = append(s.ring[1:], t)
+		t.deficit += t.cfg.Weight
+		visited = 0
+	}
+	return nil, nil, false
+}
+
+// done release the slot of a task of t.
+func (s *fairScheduler) done(t *tenant, err error) {
+	s.mu.Lock()
+	t.inflight--
+	t.last = time.Now()
+	if err != nil {
+		t.stats.Failed++
+	} else {
+		t.stats.Completed++
+	}
+	s.mu.Unlock()
+	s.signal()
+}
+
+// run dispatch tasks of tenants into task queue until pool closed, and
+// fail tasks left in tenant queues then. While workers are busy, it checks
+// for idle ones every defaultPauseCheckInterval, because tasks submitted
+// by other methods do not wake it up when done.
+func (s *fairScheduler) run() {
+	defer s.failQueued()
+	sweep := time.NewTicker(defaultTenantIdleTimeout / 2)
+	defer sweep.Stop()
+	var retry <-chan time.Time
+	for {
+		select {
+		case <-s.bp.close:
+			return
+		case <-s.wake:
+		case <-retry:
+		case now := <-sweep.C:
+			s.evict(now)
+			continue
+		}
+		retry = nil
+		for {
+			if !s.bp.waitResumed() {
+				return
+			}
+			s.mu.Lock()
+			t, te, busy := s.next()
+			s.mu.Unlock()
+			if te == nil {
+				if busy {
+					retry = time.After(defaultPauseCheckInterval)
+				}
+				break
+			}
+			if !s.bp.dispatch(s.track(t, te)) {
+				te.drop(ErrPoolClosed)
+				return
+			}
+		}
+	}
+}
+
+// track make task release its slot after done, a panicking task is done
+// with ErrTaskPanicked.
+func (s *fairScheduler) track(t *tenant, te *TaskEnvelope) *TaskEnvelope {
+	inner := te.t
+	te.t = func() (val interface{}, err error) {
+		err = ErrTaskPanicked
+		defer func() {
+			s.done(t, err)
+		}()
+		return inner()
+	}
+	te.onDrop(func() {
+		s.done(t, ErrPoolClosed)
+	})
+	return te
+}
+
+// evict remove tenants not configured and idle for defaultTenantIdleTimeout,
+// so that tenants map does not grow without bound.
+func (s *fairScheduler) evict(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, t := range s.tenants {
+		if !t.configured && !t.active && len(t.queue) == 0 && t.inflight == 0 &&
+			now.Sub(t.last) >= defaultTenantIdleTimeout {
+			delete(s.tenants, id)
+		}
+	}
+}
+
+func (s *fairScheduler) failQueued() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for _, t := range s.tenants {
+		for _, te := range t.queue {
+			te.Report(nil, ErrPoolClosed)
+		}
+		t.queue = nil
+	}
+}
+
+func (s *fairScheduler) queued() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, t := range s.tenants {
+		n += len(t.queue)
+	}
+	return n
+}
+
+func (s *fairScheduler) stats() map[string]TenantStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := make(map[string]TenantStats, len(s.tenants))
+	for id, t := range s.tenants {
+		st := t.stats
+		st.Queued, st.InFlight = len(t.queue), t.inflight
+		stats[id] = st
+	}
+	return stats
+}
+
+// busyWorkers return the number of workers occupied by running tasks and
+// tasks queued for them.
+func (bp *basicPool) busyWorkers() int {
+	return int(atomic.LoadInt64(&bp.stats.running)) + len(bp.taskQ)
+}
+
+// scheduler return the fair scheduler of pool, it is created and started
+// on first use.
+func (bp *basicPool) scheduler() *fairScheduler {
+	if fair := bp.loadScheduler(); fair != nil {
+		return fair
+	}
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	if bp.fair == nil {
+		bp.fair = newFairScheduler(bp)
+		go bp.fair.run()
+	}
+	return bp.fair
+}
+
+// loadScheduler return the fair scheduler of pool, nil if never used.
+func (bp *basicPool) loadScheduler() *fairScheduler {
+	bp.mu.RLock()
+	defer bp.mu.RUnlock()
+	return bp.fair
+}
+
+func (bp *basicPool) SubmitForTenant(tenantID string, task Task) (Future, error) {
+	// check closed
+	select {
+	case <-bp.close:
+		return nil, ErrPoolClosed
+	default:
+	}
+
+	// check paused
+	if len(bp.pause) > 0 {
+		return nil, ErrPoolPaused
+	}
+
+	rc := make(chan *taskResult, 1)
+	te := rscPool.GetTask(statelessTask(task), rc)
+	if err := bp.scheduler().enqueue(tenantID, te); err != nil {
+		return nil, err
+	}
+	return newPondFuture(rc), nil
+}
+
+func (bp *basicPool) SetTenant(tenantID string, cfg TenantConfig) {
+	bp.scheduler().setConfig(tenantID, cfg)
+}
+
+func (bp *basicPool) TenantStats() map[string]TenantStats {
+	if fair := bp.loadScheduler(); fair != nil {
+		return fair.stats()
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package pond
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFairSchedulerOrder(t *testing.T) {
+	fmt.Println(t.Name())
+	pool := NewPoolWithOptions(WithCapacity(1))
+	tenants := pool.(TenantScheduler)
+	tenants.SetTenant("b", TenantConfig{Weight: 2})
+
+	release := make(chan struct{})
+	gate, _ := tenants.SubmitForTenant("gate", func() (interface{}, error) {
+		<-release
+		return nil, nil
+	})
+
+	var mu sync.Mutex
+	var order []string
+	record := func(name string) Task {
+		return func() (interface{}, error) {
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+			return nil, nil
+		}
+	}
+	var futures []Future
+	for i := 0; i < 6; i++ {
+		future, _ := tenants.SubmitForTenant("a", record("a"))
+		futures = append(futures, future)
+	}
+	for i := 0; i < 4; i++ {
+		future, _ := tenants.SubmitForTenant("b", record("b"))
+		futures = append(futures, future)
+	}
+	close(release)
+	_, _ = gate.Value()
+	for _, future := range futures {
+		_, _ = future.Value()
+	}
+
+	if got := strings.Join(order, ""); got != "abbabbaaaa" {
+		t.Errorf("tasks should be scheduled by weights, got %s", got)
+	}
+	stats := tenants.TenantStats()
+	if stats["a"].Completed != 6 || stats["b"].Completed != 4 || stats["b"].Queued != 0 {
+		t.Errorf("tenant stats should count tasks, got %+v", stats)
+	}
+	pool.Close()
+}
+
+func TestFairSchedulerLimits(t *testing.T) {
+	fmt.Println(t.Name())
+	pool := NewPoolWithOptions(WithCapacity(2))
+	tenants := pool.(TenantScheduler)
+	tenants.SetTenant("a", TenantConfig{MaxInFlight: 1, MaxQueue: 1})
+
+	started, release := make(chan struct{}), make(chan struct{})
+	running, _ := tenants.SubmitForTenant("a", func() (interface{}, error) {
+		close(started)
+		<-release
+		return nil, nil
+	})
+	<-started
+	queued, _ := tenants.SubmitForTenant("a", foo)
+	if _, err := tenants.SubmitForTenant("a", foo); err != ErrTenantQueueFull {
+		t.Error("task beyond max queue of tenant should be rejected")
+	}
+	// other tenants are not blocked by the capped one.
+	other, _ := tenants.SubmitForTenant("b", foo)
+	if _, err := other.Value(); err != nil {
+		t.Error("task of other tenant should run:", err)
+	}
+	if stats := tenants.TenantStats()["a"]; stats.InFlight != 1 || stats.Queued != 1 || stats.Rejected != 1 {
+		t.Errorf("max in-flight of tenant should be respected, got %+v", stats)
+	}
+	close(release)
+	_, _ = running.Value()
+	_, _ = queued.Value()
+	pool.Close()
+}
+
+func TestFairSchedulerClose(t *testing.T) {
+	fmt.Println(t.Name())
+	pool := NewPoolWithOptions(WithCapacity(1))
+	tenants := pool.(TenantScheduler)
+	tenants.SetTenant("a", TenantConfig{MaxInFlight: 1})
+	release := make(chan struct{})
+	_, _ = tenants.SubmitForTenant("a", func() (interface{}, error) {
+		<-release
+		return nil, nil
+	})
+	queued, _ := tenants.SubmitForTenant("a", foo)
+	pool.Close()
+	close(release)
+	if _, err := queued.Value(); err != ErrPoolClosed {
+		t.Error("queued task of tenant should fail when pool closed")
+	}
+	// scheduler may stop after submitter checked pool.
+	fair := newFairScheduler(pool.(*basicPool))
+	fair.failQueued()
+	if err := fair.enqueue("a", rscPool.GetTask(statelessTask(foo), make(chan *taskResult, 1))); err != ErrPoolClosed {
+		t.Error("task of tenant should be rejected after scheduler stopped")
+	}
+}
+
+func TestFairSchedulerPanic(t *testing.T) {
+	fmt.Println(t.Name())
+	pool := NewPoolWithOptions(WithCapacity(1), WithMiddleware(RecoveryMiddleware()))
+	tenants := pool.(TenantScheduler)
+	tenants.SetTenant("a", TenantConfig{MaxInFlight: 1})
+	panicking, _ := tenants.SubmitForTenant("a", func() (interface{}, error) {
+		panic("tenant task panics")
+	})
+	if _, err := panicking.Value(); err == nil {
+		t.Error("panicking task should fail")
+	}
+	future, _ := tenants.SubmitForTenant("a", foo)
+	done := make(chan struct{})
+	go func() {
+		_, _ = future.Value()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("slot of panicking task should be released")
+	}
+	if stats := tenants.TenantStats()["a"]; stats.InFlight != 0 || stats.Failed != 1 {
+		t.Errorf("panicking task should be counted as failed, got %+v", stats)
+	}
+	pool.Close()
+}
+
+func TestFairSchedulerPlainTasks(t *testing.T) {
+	fmt.Println(t.Name())
+	pool := NewPoolWithOptions(WithCapacity(1))
+	tenants := pool.(TenantScheduler)
+	release := make(chan struct{})
+	plain, _ := pool.Submit(func() (interface{}, error) {
+		<-release
+		return nil, nil
+	})
+	time.Sleep(10 * time.Millisecond)
+	future, _ := tenants.SubmitForTenant("a", foo)
+	time.Sleep(20 * time.Millisecond)
+	if stats := tenants.TenantStats()["a"]; stats.Queued != 1 {
+		t.Errorf("task of tenant should wait for workers busy with other tasks, got %+v", stats)
+	}
+	close(release)
+	_, _ = plain.Value()
+	if _, err := future.Value(); err != nil {
+		t.Error("task of tenant should run once worker idle:", err)
+	}
+	pool.Close()
+}
+
+func TestFairSchedulerEvict(t *testing.T) {
+	fmt.Println(t.Name())
+	pool := NewPoolWithOptions(WithCapacity(1))
+	tenants := pool.(TenantScheduler)
+	tenants.SetTenant("a", TenantConfig{Weight: 2})
+	for _, id := range []string{"a", "b"} {
+		future, _ := tenants.SubmitForTenant(id, foo)
+		_, _ = future.Value()
+	}
+	fair := pool.(*basicPool).loadScheduler()
+	fair.evict(time.Now().Add(defaultTenantIdleTimeout))
+	stats := tenants.TenantStats()
+	if _, ok := stats["b"]; ok {
+		t.Error("idle tenant should be evicted")
+	}
+	if _, ok := stats["a"]; !ok {
+		t.Error("configured tenant should be kept")
+	}
+	pool.Close()
+}
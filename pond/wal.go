@@ -0,0 +1,384 @@
+package pond
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SyncPolicy decide when the write-ahead log is flushed to disk.
+type SyncPolicy int
+
+const (
+	// SyncAlways fsync after every record, no accepted task is lost.
+	SyncAlways SyncPolicy = iota
+	// SyncPeriodic fsync every SyncInterval, tasks accepted within the
+	// last interval may be lost on crash.
+	SyncPeriodic
+	// SyncNever leave flushing to operating system.
+	SyncNever
+)
+
+// DurableConfig configures the durable task queue, see WithDurableQueue.
+type DurableConfig struct {
+	// Dir is the directory of log segments, it is created if not exists.
+	Dir string
+
+	Sync SyncPolicy
+	// SyncInterval is the interval of SyncPeriodic, default is
+	// defaultWALSyncInterval.
+	SyncInterval time.Duration
+
+	// SegmentSize is the size a segment rolled over at, default is
+	// defaultWALSegmentSize. Segments are removed once all their tasks
+	// and tasks of older segments acknowledged.
+	SegmentSize int64
+}
+
+const (
+	walSubmit byte = iota + 1
+	walAck
+)
+
+// walEntry is a submitted task recovered from log.
+type walEntry struct {
+	seq     uint64
+	name    string
+	payload []byte
+}
+
+// wal is an append-only log of submitted and acknowledged tasks split
+// into segments, a record is:
+//
+//	length uint32 | crc32 uint32 | type byte | seq uint64 | body
+//
+// where body of submit record is name length uint16, name and payload.
+type wal struct {
+	cfg DurableConfig
+
+	mu       sync.Mutex
+	closed   bool
+	dirty    bool
+	seq      uint64
+	file     *os.File
+	size     int64
+	segments []uint64
+	// pending map unacknowledged tasks to their segments, and live count
+	// them by segments.
+	pending map[uint64]uint64
+	live    map[uint64]int
+
+	stop chan struct{}
+}
+
+// openWAL load segments under cfg.Dir and return unacknowledged tasks in
+// order of submission, new records go to a new segment.
+func openWAL(cfg DurableConfig) (*wal, []walEntry, error) {
+	if cfg.SegmentSize <= 0 {
+		cfg.SegmentSize = defaultWALSegmentSize
+	}
+	if cfg.SyncInterval <= 0 {
+		cfg.SyncInterval = defaultWALSyncInterval
+	}
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		return nil, nil, err
+	}
+	w := &wal{
+		cfg:     cfg,
+		pending: make(map[uint64]uint64),
+		live:    make(map[uint64]int),
+		stop:    make(chan struct{}),
+	}
+
+	segments, err := listSegments(cfg.Dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	entries := make(map[uint64]walEntry)
+	for _, seg := range segments {
+		if err := w.load(seg, entries); err != nil {
+			return nil, nil, err
+		}
+	}
+	w.segments = segments
+
+	next := uint64(1)
+	if len(segments) > 0 {
+		next = segments[len(segments)-1] + 1
+	}
+	if err := w.roll(next); err != nil {
+		return nil, nil, err
+	}
+	w.compact()
+
+	recovered := make([]walEntry, 0, len(entries))
+	for _, e := range entries {
+		recovered = append(recovered, e)
+	}
+	sort.Slice(recovered, func(i, j int) bool {
+		return recovered[i].seq < recovered[j].seq
+	})
+
+	if cfg.Sync == SyncPeriodic {
+		go w.syncPeriodically()
+	}
+	return w, recovered, nil
+}
+
+func segmentPath(dir string, seg uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%016x.wal", seg))
+}
+
+func listSegments(dir string) ([]uint64, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var segments []uint64
+	for _, f := range files {
+		name := f.Name()
+		if !strings.HasSuffix(name, ".wal") {
+			continue
+		}
+		seg, err := strconv.ParseUint(strings.TrimSuffix(name, ".wal"), 16, 64)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, seg)
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i] < segments[j]
+	})
+	return segments, nil
+}
+
+// load replay records of segment into entries, a torn or corrupted tail
+// left by crash ends the segment. A length beyond the rest of segment is
+// taken as corrupted too, so that garbage never causes a huge allocation.
+func (w *wal) load(seg uint64, entries map[uint64]walEntry) error {
+	f, err := os.Open(segmentPath(w.cfg.Dir, seg))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(f)
+	var header [8]byte
+	remaining := info.Size()
+	for {
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return nil
+		}
+		remaining -= int64(len(header))
+		n := int64(binary.BigEndian.Uint32(header[:4]))
+		if n > remaining {
+			return nil
+		}
+		remaining -= n
+		body := make([]byte, n)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return nil
+		}
+		if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(header[4:]) || len(body) < 9 {
+			return nil
+		}
+		seq := binary.BigEndian.Uint64(body[1:9])
+		if seq > w.seq {
+			w.seq = seq
+		}
+		switch body[0] {
+		case walSubmit:
+			if len(body) < 11 {
+				return nil
+			}
+			n := int(binary.BigEndian.Uint16(body[9:11]))
+			if len(body) < 11+n {
+				return nil
+			}
+			entries[seq] = walEntry{seq: seq, name: string(body[11 : 11+n]), payload: body[11+n:]}
+			w.pending[seq] = seg
+			w.live[seg]++
+		case walAck:
+			if owner, ok := w.pending[seq]; ok {
+				delete(entries, seq)
+				delete(w.pending, seq)
+				w.live[owner]--
+			}
+		}
+	}
+}
+
+// roll start a new active segment, caller should hold lock except in
+// openWAL.
+func (w *wal) roll(seg uint64) error {
+	if w.file != nil {
+		if err := w.file.Sync(); err != nil {
+			return err
+		}
+		w.file.Close()
+		w.file = nil
+	}
+	f, err := os.OpenFile(segmentPath(w.cfg.Dir, seg), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	w.file, w.size = f, 0
+	w.segments = append(w.segments, seg)
+	return nil
+}
+
+func (w *wal) active() uint64 {
+	return w.segments[len(w.segments)-1]
+}
+
+// append write a record, caller should hold lock.
+func (w *wal) append(typ byte, seq uint64, body []byte) error {
+	if w.closed {
+		return ErrPoolClosed
+	}
+	rec := make([]byte, 8, 17+len(body))
+	rec = append(rec, typ)
+	rec = append(rec, make([]byte, 8)...)
+	binary.BigEndian.PutUint64(rec[9:17], seq)
+	rec = append(rec, body...)
+	binary.BigEndian.PutUint32(rec[:4], uint32(len(rec)-8))
+	binary.BigEndian.PutUint32(rec[4:8], crc32.ChecksumIEEE(rec[8:]))
+
+	if w.file == nil {
+		if err := w.roll(w.active() + 1); err != nil {
+			return err
+		}
+	}
+	if _, err := w.file.Write(rec); err != nil {
+		w.rewind()
+		return err
+	}
+	if w.cfg.Sync == SyncAlways {
+		if err := w.file.Sync(); err != nil {
+			w.rewind()
+			return err
+		}
+	} else {
+		w.dirty = true
+	}
+	w.size += int64(len(rec))
+	if w.size >= w.cfg.SegmentSize {
+		// the record is logged anyway, a failed roll is retried by next
+		// append.
+		_ = w.roll(w.active() + 1)
+	}
+	return nil
+}
+
+// rewind drop the partial or unsynced record of a failed append by
+// truncating the active segment to the last good offset. If truncating
+// failed too, the segment is abandoned, loading it stops at the bad
+// record, and next append goes to a new segment. Caller should hold lock.
+func (w *wal) rewind() {
+	if err := w.file.Truncate(w.size); err == nil {
+		return
+	}
+	w.file.Close()
+	w.file = nil
+	w.dirty = false
+}
+
+// submit log a task and return its sequence number.
+func (w *wal) submit(name string, payload []byte) (uint64, error) {
+	body := make([]byte, 2, 2+len(name)+len(payload))
+	binary.BigEndian.PutUint16(body, uint16(len(name)))
+	body = append(body, name...)
+	body = append(body, payload...)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	seq := w.seq + 1
+	seg := w.active()
+	if err := w.append(walSubmit, seq, body); err != nil {
+		return 0, err
+	}
+	w.seq = seq
+	w.pending[seq] = seg
+	w.live[seg]++
+	return seq, nil
+}
+
+// ack log the completion of task, segments fully acknowledged are removed.
+func (w *wal) ack(seq uint64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	seg, ok := w.pending[seq]
+	if !ok {
+		return nil
+	}
+	if err := w.append(walAck, seq, nil); err != nil {
+		return err
+	}
+	delete(w.pending, seq)
+	w.live[seg]--
+	w.compact()
+	return nil
+}
+
+// compact remove the oldest segments as long as all their tasks are
+// acknowledged. Segments are removed in order, because acks of a task are
+// always logged in its segment or newer ones. Caller should hold lock.
+func (w *wal) compact() {
+	for len(w.segments) > 1 && w.live[w.segments[0]] == 0 {
+		if err := os.Remove(segmentPath(w.cfg.Dir, w.segments[0])); err != nil && !os.IsNotExist(err) {
+			return
+		}
+		delete(w.live, w.segments[0])
+		w.segments = w.segments[1:]
+	}
+}
+
+func (w *wal) syncPeriodically() {
+	ticker := time.NewTicker(w.cfg.SyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			w.mu.Lock()
+			if w.dirty && !w.closed && w.file != nil {
+				w.file.Sync()
+				w.dirty = false
+			}
+			w.mu.Unlock()
+		}
+	}
+}
+
+func (w *wal) close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	close(w.stop)
+	if w.file == nil {
+		return nil
+	}
+	if err := w.file.Sync(); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
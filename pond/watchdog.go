@@ -0,0 +1,181 @@
+package pond
+
+import (
+	"bytes"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// StuckTask describe a task running longer than threshold of watchdog.
+type StuckTask struct {
+	RunningTask
+	// Stack is the stack trace of goroutine running the task.
+	Stack []byte
+}
+
+// StuckTaskHandler is invoked by watchdog once for every stuck task.
+type StuckTaskHandler func(task StuckTask)
+
+// WatchdogConfig configures the watchdog of pool, which finds tasks
+// running longer than Threshold.
+type WatchdogConfig struct {
+	Threshold time.Duration
+
+	// Interval is the interval of checking running tasks, default is half
+	// of Threshold, capped by defaultWatchdogInterval.
+	Interval time.Duration
+
+	// Handler is invoked with every stuck task, it can be nil. Stack is
+	// nil for tasks executed by customized workers.
+	Handler StuckTaskHandler
+
+	// CountStuck count stuck tasks in Stats.Stuck.
+	CountStuck bool
+
+	// ReplaceWorker spawn a new worker for every stuck task so that
+	// capacity is kept, the stuck worker is retired after its task done.
+	// Customized workers are never replaced.
+	ReplaceWorker bool
+}
+
+// watch check running tasks periodically until pool closed.
+func (bp *basicPool) watch(cfg *WatchdogConfig) {
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = cfg.Threshold / 2
+		if interval <= 0 || interval > defaultWatchdogInterval {
+			interval = defaultWatchdogInterval
+		}
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-bp.close:
+			return
+		case <-ticker.C:
+		}
+
+		stuck := bp.stats.tasks.stuck(cfg.Threshold, cfg.ReplaceWorker)
+		if len(stuck) == 0 {
+			continue
+		}
+		var stacks map[uint64][]byte
+		if cfg.Handler != nil {
+			stacks = goroutineStacks()
+		}
+		for _, task := range stuck {
+			if cfg.CountStuck {
+				atomic.AddUint64(&bp.stats.stuck, 1)
+			}
+			if task.replaced {
+				bp.replaceWorker()
+			}
+			if cfg.Handler != nil {
+				if task.gid != 0 {
+					task.Stack = stacks[task.gid]
+				}
+				cfg.Handler(task.StuckTask)
+			}
+		}
+	}
+}
+
+type stuckTask struct {
+	StuckTask
+	gid      uint64
+	replaced bool
+}
+
+// stuck return tasks running longer than threshold and not reported yet,
+// they are marked replaced if replace is true and executed by default
+// workers.
+func (rt *runningTasks) stuck(threshold time.Duration, replace bool) []stuckTask {
+	now := time.Now()
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	var stuck []stuckTask
+	for _, task := range rt.tasks {
+		if task.reported || now.Sub(task.started) < threshold {
+			continue
+		}
+		task.reported, task.replaced = true, replace && task.worker != nil
+		st := stuckTask{StuckTask: StuckTask{RunningTask: task.describe(now)}, replaced: task.replaced}
+		if task.worker != nil {
+			st.gid = task.worker.gid
+		}
+		stuck = append(stuck, st)
+	}
+	return stuck
+}
+
+// replaceWorker spawn an extra worker for a stuck one.
+func (bp *basicPool) replaceWorker() {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	select {
+	case <-bp.close:
+		return
+	default:
+	}
+	bp.spawnWorker()
+}
+
+// retireWorker close worker w replaced by replaceWorker after its stuck
+// task done. It keeps w serving if pool has no extra workers, e.g. grown
+// by scale after replaced, and it is a no-op if w has been removed, e.g.
+// by SetCapacity.
+func (bp *basicPool) retireWorker(w *pondWorker) {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	if len(bp.workers) <= bp.capacity {
+		return
+	}
+	for i, worker := range bp.workers {
+		if worker == Worker(w) {
+			w.Close()
+			n := len(bp.workers)
+			copy(bp.workers[i:], bp.workers[i+1:])
+			bp.workers[n-1] = nil
+			bp.workers = bp.workers[:n-1]
+			return
+		}
+	}
+}
+
+// goroutineID return id of current goroutine parsed from its stack trace,
+// which starts with "goroutine 1 [running]:".
+func goroutineID() uint64 {
+	var buf [64]byte
+	return parseGoroutineID(buf[:runtime.Stack(buf[:], false)])
+}
+
+func parseGoroutineID(stack []byte) uint64 {
+	stack = bytes.TrimPrefix(stack, []byte("goroutine "))
+	if i := bytes.IndexByte(stack, ' '); i > 0 {
+		stack = stack[:i]
+	}
+	id, _ := strconv.ParseUint(string(stack), 10, 64)
+	return id
+}
+
+// goroutineStacks return stack traces of all goroutines by their ids.
+func goroutineStacks() map[uint64][]byte {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	stacks := make(map[uint64][]byte)
+	for _, stack := range bytes.Split(buf, []byte("\n\n")) {
+		stacks[parseGoroutineID(stack)] = stack
+	}
+	return stacks
+}
@@ -0,0 +1,122 @@
+package pond
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestWatchdog(t *testing.T) {
+	fmt.Println(t.Name())
+	reported := make(chan StuckTask, 1)
+	pool := NewPoolWithOptions(WithCapacity(1), WithWatchdog(WatchdogConfig{
+		Threshold:     20 * time.Millisecond,
+		Interval:      5 * time.Millisecond,
+		Handler:       func(task StuckTask) { reported <- task },
+		CountStuck:    true,
+		ReplaceWorker: true,
+	}))
+	defer pool.Close()
+
+	release := make(chan struct{})
+	stuck, _ := pool.Submit(func() (interface{}, error) {
+		<-release
+		return nil, nil
+	})
+
+	var task StuckTask
+	select {
+	case task = <-reported:
+	case <-time.After(time.Second):
+		t.Error("stuck task should be reported")
+		return
+	}
+	if task.Elapsed < 20*time.Millisecond {
+		t.Errorf("stuck task should run longer than threshold, got %v", task.Elapsed)
+	}
+	if !bytes.Contains(task.Stack, []byte("TestWatchdog")) {
+		t.Errorf("stack of stuck task should be captured, got %s", task.Stack)
+	}
+	if n := pool.(StatsReporter).Stats().Stuck; n != 1 {
+		t.Errorf("stuck task should be counted, got %d", n)
+	}
+	if workers := pool.Workers(); workers != 2 {
+		t.Errorf("stuck worker should be replaced, got %d workers", workers)
+	}
+
+	// replaced worker keeps pool serving.
+	future, _ := pool.Submit(func() (interface{}, error) { return 1, nil })
+	if val, _ := future.Value(); val != 1 {
+		t.Error("execution result should be 1!")
+	}
+
+	close(release)
+	_, _ = stuck.Value()
+	deadline := time.Now().Add(time.Second)
+	for pool.Workers() != 1 {
+		if time.Now().After(deadline) {
+			t.Errorf("stuck worker should be retired, got %d workers", pool.Workers())
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case task := <-reported:
+		t.Errorf("stuck task should be reported once, got %+v", task)
+	default:
+	}
+}
+
+func TestWatchdogRetireStuckWorker(t *testing.T) {
+	fmt.Println(t.Name())
+	reported := make(chan struct{}, 1)
+	pool := NewPoolWithOptions(WithCapacity(2), WithWatchdog(WatchdogConfig{
+		Threshold:     20 * time.Millisecond,
+		Interval:      5 * time.Millisecond,
+		Handler:       func(StuckTask) { reported <- struct{}{} },
+		ReplaceWorker: true,
+	}))
+	defer pool.Close()
+
+	release := make(chan struct{})
+	stuck, _ := pool.Submit(func() (interface{}, error) {
+		<-release
+		return nil, nil
+	})
+	<-reported
+	// the other workers are busy when stuck task done, only the stuck one
+	// should be retired.
+	busy := make(chan struct{})
+	var futures []Future
+	for i := 0; i < 2; i++ {
+		future, _ := pool.Submit(func() (interface{}, error) {
+			<-busy
+			return nil, nil
+		})
+		futures = append(futures, future)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	_, _ = stuck.Value()
+	time.Sleep(10 * time.Millisecond)
+	close(busy)
+	for _, future := range futures {
+		if _, err := future.Value(); err != nil {
+			t.Error("tasks on other workers should be done:", err)
+		}
+	}
+	if workers := pool.Workers(); workers != 2 {
+		t.Errorf("capacity should be kept after stuck worker retired, got %d workers", workers)
+	}
+}
+
+func TestParseGoroutineID(t *testing.T) {
+	fmt.Println(t.Name())
+	if id := parseGoroutineID([]byte("goroutine 42 [running]:\nmain.main()")); id != 42 {
+		t.Errorf("goroutine id should be 42, got %d", id)
+	}
+	if id := goroutineID(); id == 0 {
+		t.Error("id of current goroutine should be parsed")
+	}
+}
@@ -1,18 +1,26 @@
 package pond
 
 import (
+	"sync/atomic"
 	"time"
 )
 
 // Worker represents a executor broker for goroutine, do the real job
-// and obtained by Pool.
+// and obtained by Pool. Users can implement their own workers and pass
+// the constructor to NewCustomizedWorkerPool.
 type Worker interface {
-	// Init do some initial working before worker launch.
-	Init()
+	// Init do some initial working before worker launch, pool invoke it
+	// in a new goroutine right after worker constructed. Worker will be
+	// discarded if error returned, and the error is passed to handler of
+	// WithErrorHandler.
+	Init() error
 
-	// run start worker service listening for task coming, it should be
-	// invoked instantly when worker created.
-	run()
+	// Run start worker service listening for task coming, pool invoke
+	// it in the same goroutine as Init after worker initialized, so that
+	// both of them run on the OS thread locked by WithLockOSThread. Received tasks
+	// should be executed by TaskEnvelope.Execute, or reported by
+	// TaskEnvelope.Report, and Run should return once worker closed.
+	Run()
 
 	// Idle return whether worker is in long-idle state which indicate
 	// can be recycled.
@@ -27,31 +35,63 @@ type pondWorker struct {
 	// taskQ is a replication of Pool.taskQ, workers preempt tasks over
 	// task queue, and it is the main communicate entry for workers and
 	// the pool.
-	taskQ chan *taskWrapper
+	taskQ <-chan *TaskEnvelope
 	close chan struct{}
-	idle  bool
+	idle  int32
+	// gid is id of goroutine running worker, so that watchdog can find
+	// stacks of stuck tasks.
+	gid uint64
+
+	// state is owned by worker and passed to every task it executes,
+	// see WithWorkerState.
+	state        interface{}
+	stateInit    func() (interface{}, error)
+	stateCleanup func(interface{})
 }
 
 // WorkCtor is a worker constructor and return a new worker instance,
 // Workers preempt tasks over task queue, and it is the main communicate
 // entry for workers and the pool.
-type WorkerCtor func(tq chan *taskWrapper) Worker
+type WorkerCtor func(tq <-chan *TaskEnvelope) Worker
 
-func newPondWorker(tq chan *taskWrapper) Worker {
-	pw := &pondWorker{
+func newPondWorker(tq <-chan *TaskEnvelope) Worker {
+	return &pondWorker{
 		taskQ: tq,
 		close: make(chan struct{}, 1),
-		idle:  false,
 	}
-	go pw.run()
-	return pw
 }
 
-func (pw *pondWorker) Init() {}
+// pondWorkerCtor return the default worker constructor configured by
+// pool options.
+func pondWorkerCtor(o *options) WorkerCtor {
+	return func(tq <-chan *TaskEnvelope) Worker {
+		pw := newPondWorker(tq).(*pondWorker)
+		pw.stateInit, pw.stateCleanup = o.stateInit, o.stateCleanup
+		return pw
+	}
+}
+
+func (pw *pondWorker) Init() error {
+	if pw.stateInit == nil {
+		return nil
+	}
+	state, err := pw.stateInit()
+	if err != nil {
+		return err
+	}
+	pw.state = state
+	return nil
+}
 
-func (pw *pondWorker) run() {
+func (pw *pondWorker) Run() {
+	pw.gid = goroutineID()
 	timer := time.NewTimer(defaultWorkerIdleDuration)
 	defer timer.Stop()
+	// state may be in use until the last task done, so it is cleaned
+	// up after worker stopped rather than in Close.
+	if pw.stateCleanup != nil {
+		defer pw.stateCleanup(pw.state)
+	}
 
 	for {
 		select {
@@ -61,10 +101,10 @@ func (pw *pondWorker) run() {
 			if task == nil {
 				continue
 			}
-			pw.idle = false
+			atomic.StoreInt32(&pw.idle, 0)
 
-			task.resChan <- rscPool.GetTaskResult(task.t())
-			rscPool.PutTask(task)
+			task.worker = pw
+			task.ExecuteWithState(pw.state)
 
 			// check closing
 			select {
@@ -74,14 +114,14 @@ func (pw *pondWorker) run() {
 				timer.Reset(defaultWorkerIdleDuration)
 			}
 		case <-timer.C:
-			pw.idle = true
+			atomic.StoreInt32(&pw.idle, 1)
 			timer.Reset(defaultWorkerIdleDuration)
 		}
 	}
 }
 
 func (pw *pondWorker) Idle() bool {
-	return pw.idle
+	return atomic.LoadInt32(&pw.idle) != 0
 }
 
 func (pw *pondWorker) Close() {